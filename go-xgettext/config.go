@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigName is the project configuration file looked up by
+// findProjectConfig. Its keys are the names of the command line
+// options, e.g.
+//
+//	keyword: [i18n.G, "i18n.NG:1,2"]
+//	exclude: [vendor]
+//	output: po/messages.pot
+//	sort-output-by: file
+const projectConfigName = ".xgettext.yaml"
+
+// configPathFlags are the options taking a file name, relative names in
+// the project configuration are relative to its directory
+var configPathFlags = map[string]bool{
+	"output":             true,
+	"keyword-cfg":        true,
+	"files-from":         true,
+	"diagnostics-output": true,
+	"relative-to":        true,
+}
+
+// findProjectConfig returns the projectConfigName file in dir or in
+// one of its parents up to the module root, the first directory with
+// a go.mod, or "" if there is none
+func findProjectConfig(dir string) string {
+	for {
+		fname := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(fname); err == nil {
+			return fname
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// applyProjectConfig sets the options of the project configuration
+// fname that are not given on the command line
+func applyProjectConfig(fs *flag.FlagSet, fname string) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("cannot parse %s: %v", fname, err)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var names []string
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir := filepath.Dir(fname)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in %s", name, fname)
+		}
+		if given[name] {
+			continue
+		}
+		values, ok := cfg[name].([]interface{})
+		if !ok {
+			values = []interface{}{cfg[name]}
+		}
+		for _, value := range values {
+			s := ""
+			if value != nil {
+				s = fmt.Sprint(value)
+			}
+			if configPathFlags[name] && s != "" && s != "-" && !filepath.IsAbs(s) {
+				s = filepath.Join(dir, s)
+			}
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("invalid option %q in %s: %v", name, fname, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadProjectConfig applies the --config file or the one found by
+// findProjectConfig to the command line options
+func loadProjectConfig() error {
+	if *noConfig {
+		return nil
+	}
+	fname := *configFile
+	if fname == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if fname = findProjectConfig(cwd); fname == "" {
+			return nil
+		}
+	}
+	return applyProjectConfig(flag.CommandLine, fname)
+}
@@ -0,0 +1,131 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diagnostic is a WARN: or NOTE: line as written with --diagnostics=json
+type diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+var diagnosticsFormats = map[string]bool{
+	"":     true,
+	"text": true,
+	"json": true,
+}
+
+// warnf reports a problem at pos, code identifies its kind in the json
+// diagnostics
+func (e *Extractor) warnf(pos token.Position, code, format string, a ...interface{}) {
+	e.report(pos, "warning", code, format, a...)
+}
+
+// notef reports something worth knowing about pos, usually only done
+// with Verbose
+func (e *Extractor) notef(pos token.Position, code, format string, a ...interface{}) {
+	e.report(pos, "note", code, format, a...)
+}
+
+// report writes a diagnostic unless pos is in a file matched by
+// IgnoreErrorsIn
+func (e *Extractor) report(pos token.Position, severity, code, format string, a ...interface{}) {
+	for _, pattern := range e.IgnoreErrorsIn {
+		// patterns without a directory match the file name anywhere
+		if ok, _ := filepath.Match(pattern, pos.Filename); ok {
+			return
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(pos.Filename)); ok {
+			return
+		}
+	}
+
+	var out io.Writer = os.Stderr
+	if e.DiagnosticsOutput != nil {
+		out = e.DiagnosticsOutput
+	}
+	if e.DiagnosticsFormat != "json" {
+		prefix := "WARN: "
+		if severity == "note" {
+			prefix = "NOTE: "
+		}
+		fmt.Fprintf(out, prefix+format, a...)
+		return
+	}
+
+	d := diagnostic{
+		File:     pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Severity: severity,
+		Code:     code,
+		Message:  strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"),
+	}
+	// a diagnostic that cannot be encoded is not worth failing for
+	if b, err := json.Marshal(d); err == nil {
+		fmt.Fprintf(out, "%s\n", b)
+	}
+}
+
+// parsePosition parses a "file:line:column" position as reported by
+// the go tool, line and column are optional
+func parsePosition(s string) token.Position {
+	var pos token.Position
+	parts := strings.Split(s, ":")
+	var nums []int
+	// the file name itself may contain colons
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	if len(nums) > 0 {
+		pos.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		pos.Column = nums[1]
+	}
+	pos.Filename = strings.Join(parts, ":")
+	return pos
+}
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// embedDirective starts the comments embedding a file in the variable
+// declared after them
+const embedDirective = "//go:embed "
+
+// collectEmbeds adds the package level string variables of f that embed
+// a single file to e.embeds, keyed like e.consts
+func (e *Extractor) collectEmbeds(fset *token.FileSet, f *ast.File) {
+	dir := filepath.Dir(fset.Position(f.Pos()).Filename)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vspec := spec.(*ast.ValueSpec)
+			if len(vspec.Names) != 1 || types.ExprString(vspec.Type) != "string" {
+				continue
+			}
+			doc := vspec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			pattern := embedPattern(doc)
+			if pattern == "" {
+				continue
+			}
+			e.embeds[f.Name.Name+"."+vspec.Names[0].Name] = filepath.Join(dir, filepath.FromSlash(pattern))
+		}
+	}
+}
+
+// embedPattern returns the file named by the go:embed directive of doc,
+// empty unless it names exactly one file
+func embedPattern(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, embedDirective) {
+			continue
+		}
+		for _, pattern := range strings.Fields(strings.TrimPrefix(c.Text, embedDirective)) {
+			if unquoted, err := strconv.Unquote(pattern); err == nil {
+				pattern = unquoted
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) != 1 || strings.ContainsAny(patterns[0], "*?[") {
+		return ""
+	}
+	return patterns[0]
+}
+
+// embedAsset returns the file embedded by the variable expr refers to,
+// only with ExtractEmbed
+func (e *Extractor) embedAsset(f *ast.File, expr ast.Expr) (string, bool) {
+	if !e.ExtractEmbed {
+		return "", false
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		if _, ok := e.locals[ident.Name]; ok {
+			return "", false
+		}
+	}
+	asset, ok := e.embeds[constKey(f, expr)]
+	return asset, ok
+}
+
+// embedValue returns the contents of the embedded file as a quoted
+// string, like constructValue does for literals
+func embedValue(asset string) (string, error) {
+	content, err := os.ReadFile(asset)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Quote(string(content)), nil
+}
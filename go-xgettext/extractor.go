@@ -0,0 +1,1832 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kTypeSingular         = "singular"
+	kTypePlural           = "plural"
+	kTypeContextual       = "contextual"
+	kTypePluralContextual = "pluralContextual"
+	kTypeDomain           = "domain"
+	kTypePluralDomain     = "pluralDomain"
+)
+
+type keywordDef struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	SkipArgs int    `json:"skipArgs"`
+	// NamePattern is a regular expression matching the names of a
+	// family of functions, e.g. pkg\.msg[A-Z]\w*, Name is only a
+	// label then
+	NamePattern string `json:"namePattern"`
+	// ImportPath restricts the keyword to the function Name of this
+	// package, for packages exporting functions of the same name
+	ImportPath string `json:"importPath"`
+	// Format is the flag always written for the strings of this
+	// keyword, no-format writes no-c-format and auto (or empty)
+	// detects it like for other keywords
+	Format string `json:"format"`
+	// Domain overrides Extractor.Domain for the strings of this keyword
+	Domain string `json:"domain"`
+
+	// explicit argument positions, they override SkipArgs
+	MsgctxtArg     *int `json:"msgctxtArg"`
+	MsgidArg       *int `json:"msgidArg"`
+	MsgidPluralArg *int `json:"msgidPluralArg"`
+	DomainArg      *int `json:"domainArg"`
+	// MsgidArgs are the positions of several msgid arguments of
+	// singular keywords, e.g. for dialog.New(title, body, okLabel),
+	// they override MsgidArg. With MsgidRest all arguments after the
+	// last one are msgids too.
+	MsgidArgs []int `json:"msgidArgs"`
+	MsgidRest bool  `json:"msgidRest"`
+	// AutoComment is a fixed translator hint added as extracted
+	// comment to every string of this keyword, e.g. "This is a
+	// button label"
+	AutoComment string `json:"autoComment"`
+}
+
+func (k *keywordDef) domainIdx() int {
+	if k.DomainArg != nil {
+		return *k.DomainArg
+	}
+	return k.SkipArgs
+}
+
+func (k *keywordDef) msgctxtIdx() int {
+	if k.MsgctxtArg != nil {
+		return *k.MsgctxtArg
+	}
+	return k.SkipArgs
+}
+
+func (k *keywordDef) msgidIdx() int {
+	if len(k.MsgidArgs) > 0 {
+		return k.MsgidArgs[0]
+	}
+	if k.MsgidArg != nil {
+		return *k.MsgidArg
+	}
+	switch k.Type {
+	case kTypeContextual, kTypePluralContextual:
+		return k.msgctxtIdx() + 1
+	case kTypeDomain, kTypePluralDomain:
+		return k.domainIdx() + 1
+	}
+	return k.SkipArgs
+}
+
+// msgidIdxs returns the positions of the msgid arguments of a call with
+// nargs arguments
+func (k *keywordDef) msgidIdxs(nargs int) []int {
+	if len(k.MsgidArgs) == 0 {
+		return []int{k.msgidIdx()}
+	}
+	idxs := append([]int(nil), k.MsgidArgs...)
+	if k.MsgidRest {
+		for i := idxs[len(idxs)-1] + 1; i < nargs; i++ {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+func (k *keywordDef) msgidPluralIdx() int {
+	if k.MsgidPluralArg != nil {
+		return *k.MsgidPluralArg
+	}
+	return k.msgidIdx() + 1
+}
+
+// key returns the keywords key of k, the qualified function name
+func (k *keywordDef) key() string {
+	if k.ImportPath != "" {
+		return k.ImportPath + "." + k.Name
+	}
+	return k.Name
+}
+
+type keywords map[string]*keywordDef
+
+type allKeywordsConfig []*keywordDef
+
+type msgID struct {
+	msgidPlural string
+	msgctxt     string
+	comment     string
+	autoComment string
+	fname       string
+	line        int
+	formatHint  string
+	// the column and byte offset of the location, only set with
+	// Columns
+	column int
+	offset int
+	// the first and last line of the msgid literal, only set with
+	// LiteralLocation and LocationEndLine
+	literalLine int
+	endLine     int
+	// the domain of the string, empty for the default one
+	domain string
+
+	// only set for entries read by parsePotFile
+	translatorComment string
+	fuzzy             bool
+}
+
+// Extractor extracts translatable strings from Go source files and
+// writes them as a catalog template. The zero value extracts nothing,
+// at least Keywords needs to be set.
+type Extractor struct {
+	Keywords keywords
+
+	// Verbose prints notes about the processed files to stderr
+	Verbose bool
+	// AddComments places all comment blocks preceding keyword
+	// lines in the output, AddCommentsTags only those with a line
+	// starting with one of the tags, from that line on, see
+	// taggedComment
+	AddComments     bool
+	AddCommentsTags []string
+	MaxCommentLines int
+	// SortBy is one of the keys of sortOrders or empty for no
+	// particular order
+	SortBy string
+	// AddLocation is one of the location* constants, empty means
+	// locationFull
+	AddLocation string
+	// Width wraps the strings of the PO output at this column in the
+	// GNU xgettext layout, NoWrap uses that layout without wrapping,
+	// see formatString
+	Width  int
+	NoWrap bool
+	// LiteralLocation adds the line of the msgid literal to the
+	// location when it differs from the line of the call
+	LiteralLocation bool
+	// LocationEndLine adds the last line of multi-line msgid literals
+	// to the location
+	LocationEndLine bool
+	// Columns records the column and byte offset of the locations,
+	// the JSON and XML outputs include them
+	Columns bool
+	// LocationColumns writes "file:line:col" references instead of
+	// "file:line", it implies Columns
+	LocationColumns bool
+	// StripFilePrefix is removed from the file names in locations,
+	// RelativeTo takes precedence and makes them relative to a
+	// directory
+	StripFilePrefix string
+	RelativeTo      string
+	// PrefixMap replaces the longest matching directory prefix of the
+	// file names in locations before StripFilePrefix and RelativeTo
+	// apply, see mapPrefix
+	PrefixMap []prefixMapping
+
+	// OmitHeader leaves out the header entry, e.g. for fragments
+	// merged by other tools
+	OmitHeader      bool
+	CopyrightHolder string
+	CopyrightYear   int
+	// ForeignUser writes a public domain notice instead of the
+	// copyright lines
+	ForeignUser         bool
+	Charset             string
+	PackageName         string
+	PackageVersion      string
+	MsgIDBugsAddress    string
+	NoFuzzy             bool
+	Language            string
+	LanguageTeam        string
+	TranslationURL      string
+	RevisionDate        bool
+	RevisionDateFromGit bool
+	// CreationTime is the POT-Creation-Date instead of the current
+	// time, e.g. from SOURCE_DATE_EPOCH, NoDate leaves it out
+	CreationTime time.Time
+	NoDate       bool
+	// HeaderFields replace the header fields with the same key, in
+	// any case, or are added after them
+	HeaderFields []headerField
+
+	AddPluralFormsComment bool
+	// PluralForms is the number of msgstr[N] slots of plural
+	// entries, 0 means 2, PluralFormula is written verbatim as the
+	// Plural-Forms header
+	PluralForms   int
+	PluralFormula string
+	AddMetadata   bool
+	// ContextualKeySeparator joins msgctxt and msgid in output
+	// formats that identify entries by a single key
+	ContextualKeySeparator string
+	// FormatHint is one of formatHints, the empty string is the
+	// same as auto
+	FormatHint string
+	// Domain is the domain of the extracted strings, with
+	// MsgidDomainPrefix it is put in front of their msgctxt so the
+	// same msgid in different domains gives separate entries
+	Domain            string
+	MsgidDomainPrefix bool
+
+	WarnPluralWithoutN bool
+	WarnPluralFormat   bool
+	// ValidateCalls reports keyword calls whose arguments do not
+	// match the keyword definition
+	ValidateCalls bool
+	// WarnDynamic reports keyword calls whose message arguments are
+	// only known at runtime, e.g. variables or the result of
+	// fmt.Sprintf
+	WarnDynamic bool
+	// IgnoreErrorsIn are glob patterns of files whose WARN: and
+	// NOTE: output is suppressed
+	IgnoreErrorsIn []string
+	// DiagnosticsFormat is "text" (the default) or "json" for one
+	// JSON object per WARN: or NOTE: line
+	DiagnosticsFormat string
+	// DiagnosticsOutput receives the diagnostics, stderr if nil
+	DiagnosticsOutput io.Writer
+
+	// SkipTests skips the _test.go files given to Extract with a
+	// warning, those of directory arguments are left out by walkDir
+	SkipTests bool
+	// BuildContext skips the files that are excluded by build
+	// constraints or file name suffixes in that context, nil
+	// processes all files
+	BuildContext *build.Context
+	// ContinueOnError skips files that cannot be read or parsed
+	// instead of failing Extract
+	ContinueOnError bool
+	// AutoKeywords treats functions wrapping a keyword call as
+	// keywords, see discoverWrappers
+	AutoKeywords bool
+	// TrackFuncValues treats calls of local variables and parameters
+	// holding a keyword function as calls of that keyword, see
+	// collectFuncValues
+	TrackFuncValues bool
+	// AllPlatforms marks the strings of files built only for some
+	// platforms or build tags with a comment
+	AllPlatforms bool
+	// TypeCheck loads the files as packages and matches keywords by
+	// the called function, see loadPackages
+	TypeCheck bool
+	// KeepObsolete makes Join keep the entries no longer found in
+	// the source as obsolete (#~) entries
+	KeepObsolete bool
+
+	ExtractCobra      bool
+	ExtractCobraFlags bool
+	ExtractGoGenerate *regexp.Regexp
+	ExtractSQLComment bool
+	// ExtractEmbed extracts the contents of //go:embed string
+	// variables used as msgid, located in the embedded file
+	ExtractEmbed bool
+	// KeywordFields are the struct fields whose literal values are
+	// extracted, by type name as written in the source (e.g.
+	// cli.Command) and field name
+	KeywordFields map[string]map[string]bool
+	// PluralFields pair keyword fields of the same type as msgid and
+	// msgid_plural, by type name and the field of the msgid, e.g.
+	// i18n.Message One and Other
+	PluralFields map[string]map[string]string
+
+	msgIDs         map[string][]msgID
+	obsoleteMsgIDs map[string][]msgID
+	// the package level constants of all files given to Extract
+	consts map[string]constDef
+	// the package level types with string as underlying type, keyed
+	// like consts
+	stringTypes map[string]bool
+	resolving   map[string]bool
+	// the embedded files of package level variables, keyed like consts
+	embeds map[string]string
+	// the build constraints of the processed files with AllPlatforms
+	constraints map[string]string
+	// the xgettext: directives of the file being processed by line
+	directives map[int]string
+	// the keywords found by discoverWrappers
+	wrappers keywords
+	// the keywords with a NamePattern, sorted by name
+	patterns []keywordPattern
+	// the keyword calls inside of the wrappers
+	wrapperCalls map[*ast.CallExpr]bool
+	// the // msgctxt: comments of the file being processed by line
+	contextComments map[int]string
+	// the number of keyword calls skipped for // xgettext:ignore
+	suppressed int
+	// the variables assigned once in the function being processed
+	locals map[string]ast.Expr
+	// the parameters of the function being processed that are passed
+	// keywords, with TrackFuncValues
+	funcValues map[string]*keywordDef
+	// the type information of the files loaded with TypeCheck
+	typesInfo map[*ast.File]*types.Info
+	// the source files processed by Extract
+	processedFiles []string
+	// the source files skipped by Extract with ContinueOnError
+	failedFiles []string
+}
+
+// msgIDKeySeparator separates msgctxt and msgid in the keys of
+// msgIDs, a raw \x04 never appears in the escaped strings
+const msgIDKeySeparator = "\x04"
+
+// msgIDKey returns the key of msgIDs for the given msgctxt and msgid
+func msgIDKey(msgctxt, msgid string) string {
+	if msgctxt == "" {
+		return msgid
+	}
+	return msgctxt + msgIDKeySeparator + msgid
+}
+
+func (e *Extractor) addMsgID(msgidStr string, m msgID) {
+	// tell translators the string is only used by tests
+	if strings.HasSuffix(m.fname, "_test.go") {
+		m.autoComment += "#. (test file)\n"
+	}
+	if c := e.constraints[m.fname]; c != "" {
+		m.autoComment += fmt.Sprintf("#. (build constraint: %s)\n", c)
+	}
+	if !e.Columns && !e.LocationColumns {
+		m.column, m.offset = 0, 0
+	}
+	m.fname = e.locationName(m.fname)
+	k := msgIDKey(m.msgctxt, msgidStr)
+	e.msgIDs[k] = append(e.msgIDs[k], m)
+}
+
+// locationName returns fname as written in "#:" comments, relative to
+// RelativeTo or without StripFilePrefix
+func (e *Extractor) locationName(fname string) string {
+	if name, ok := e.mapPrefix(fname); ok {
+		return name
+	}
+	if e.RelativeTo != "" {
+		base, err := filepath.Abs(e.RelativeTo)
+		if err != nil {
+			return fname
+		}
+		abs, err := filepath.Abs(fname)
+		if err != nil {
+			return fname
+		}
+		if rel, err := filepath.Rel(base, abs); err == nil {
+			return rel
+		}
+		return fname
+	}
+	return strings.TrimPrefix(fname, e.StripFilePrefix)
+}
+
+// prefixMapping replaces the directory prefix old of file names by new,
+// an empty new strips it
+type prefixMapping struct {
+	old, new string
+}
+
+// mapPrefix applies the longest prefix of e.PrefixMap matching whole
+// directories of fname, absolute prefixes also match relative file
+// names by their absolute path
+func (e *Extractor) mapPrefix(fname string) (string, bool) {
+	var best *prefixMapping
+	rest := ""
+	for i, m := range e.PrefixMap {
+		name := fname
+		if filepath.IsAbs(m.old) && !filepath.IsAbs(name) {
+			if abs, err := filepath.Abs(name); err == nil {
+				name = abs
+			}
+		}
+		old := strings.TrimSuffix(m.old, "/")
+		if !strings.HasPrefix(name, old+"/") {
+			continue
+		}
+		if best == nil || len(m.old) > len(best.old) {
+			best = &e.PrefixMap[i]
+			rest = name[len(old)+1:]
+		}
+	}
+	if best == nil {
+		return fname, false
+	}
+	if best.new == "" {
+		return rest, true
+	}
+	return strings.TrimSuffix(best.new, "/") + "/" + rest, true
+}
+
+// msgidFromKey returns the msgid part of a key of msgIDs
+func msgidFromKey(k string) string {
+	if idx := strings.Index(k, msgIDKeySeparator); idx >= 0 {
+		return k[idx+len(msgIDKeySeparator):]
+	}
+	return k
+}
+
+// domainContext prepends the domain to msgctxt when MsgidDomainPrefix
+// is set, the keyword domain takes precedence over Extractor.Domain
+func (e *Extractor) domainContext(keywordDomain, msgctxt string) string {
+	if !e.MsgidDomainPrefix {
+		return msgctxt
+	}
+	// msgctxt and the keyword domain are stored escaped
+	domain := poEscape(e.Domain)
+	if keywordDomain != "" {
+		domain = keywordDomain
+	}
+	if domain == "" {
+		return msgctxt
+	}
+	if msgctxt == "" {
+		return domain
+	}
+	return domain + poEscape(e.ContextualKeySeparator) + msgctxt
+}
+
+func formatComment(com string) string {
+	out := ""
+	for _, rawline := range strings.Split(com, "\n") {
+		line := rawline
+		line = strings.TrimPrefix(line, "//")
+		line = strings.TrimPrefix(line, "/*")
+		line = strings.TrimSuffix(line, "*/")
+		line = strings.TrimSpace(line)
+		if line != "" {
+			out += fmt.Sprintf("#. %s\n", line)
+		}
+	}
+
+	return out
+}
+
+// taggedComment returns the lines of the formatted comment com from the
+// first one starting with one of e.AddCommentsTags on, or "" if none
+// does. Tags match in any case and with or without a trailing colon,
+// e.g. "TRANSLATORS:" matches "// translators: ..." and
+// "// TRANSLATORS ...".
+func (e *Extractor) taggedComment(com string) string {
+	lines := strings.SplitAfter(com, "\n")
+	for i, line := range lines {
+		text := strings.TrimPrefix(line, "#. ")
+		for _, tag := range e.AddCommentsTags {
+			tag = strings.TrimSuffix(strings.TrimSpace(tag), ":")
+			if len(text) < len(tag) || !strings.EqualFold(text[:len(tag)], tag) {
+				continue
+			}
+			// the tag must be a whole word
+			if rest := text[len(tag):]; tag == "" || rest == "" || strings.IndexAny(rest[:1], ": \t\n") == 0 {
+				return strings.Join(lines[i:], "")
+			}
+		}
+	}
+	return ""
+}
+
+func (e *Extractor) findCommentsForTranslation(fset *token.FileSet, f *ast.File, posCall token.Position) string {
+	com := ""
+	for _, cg := range f.Comments {
+		// search for all comments in the previous line
+		for i := len(cg.List) - 1; i >= 0; i-- {
+			c := cg.List[i]
+
+			posComment := fset.Position(c.End())
+			//println(posCall.Line, posComment.Line, c.Text)
+			if posCall.Line == posComment.Line+1 {
+				// continue the search above the start of this
+				// comment, a /* */ comment may span several lines
+				posCall = fset.Position(c.Pos())
+				com = fmt.Sprintf("%s\n%s", c.Text, com)
+			}
+		}
+	}
+
+	// only return if we have a matching prefix
+	formatedComment := formatComment(com)
+	if len(e.AddCommentsTags) > 0 {
+		formatedComment = e.taggedComment(formatedComment)
+	}
+
+	// avoid huge comment blocks from e.g. preceding doc comments, keep
+	// the lines next to the call or, with tags, those from the tagged
+	// line on
+	if e.MaxCommentLines > 0 {
+		lines := strings.SplitAfter(strings.TrimSuffix(formatedComment, "\n"), "\n")
+		if len(lines) > e.MaxCommentLines {
+			if len(e.AddCommentsTags) > 0 {
+				lines = lines[:e.MaxCommentLines]
+			} else {
+				lines = lines[len(lines)-e.MaxCommentLines:]
+			}
+			formatedComment = strings.TrimSuffix(strings.Join(lines, ""), "\n") + "\n"
+		}
+	}
+
+	return formatedComment
+}
+
+func (e *Extractor) constructValue(f *ast.File, val interface{}) (string, error) {
+	switch val.(type) {
+	// literals are normalized to a double quoted string so that the
+	// value does not depend on the quoting used in the source
+	case *ast.BasicLit:
+		lit := val.(*ast.BasicLit)
+		if lit.Kind != token.STRING {
+			return "", fmt.Errorf("not a string literal: %s", lit.Value)
+		}
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Quote(s), nil
+	// this happens for constructs like:
+	//  gettext.Gettext("foo" + "bar" +
+	//      `baz`)
+	// the operands are joined by value, at any depth
+	case *ast.BinaryExpr:
+		// we only support string concat
+		if val.(*ast.BinaryExpr).Op != token.ADD {
+			return "", nil
+		}
+		// the type checker knows the value of constant expressions
+		// as a whole, also with constants of other packages
+		if info := e.typesInfo[f]; info != nil {
+			if value, err := typedConstValue(info, val.(ast.Expr)); err == nil {
+				return value, nil
+			}
+		}
+		left, err := e.constructValue(f, val.(*ast.BinaryExpr).X)
+		if err != nil {
+			return "", err
+		}
+		right, err := e.constructValue(f, val.(*ast.BinaryExpr).Y)
+		if err != nil {
+			return "", err
+		}
+		if left == "" || right == "" {
+			return "", nil
+		}
+		leftValue, err := strconv.Unquote(left)
+		if err != nil {
+			return "", err
+		}
+		rightValue, err := strconv.Unquote(right)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Quote(leftValue + rightValue), nil
+	// this happens for constructs like:
+	//  gettext.Gettext(("foo " +
+	//      "bar"))
+	case *ast.ParenExpr:
+		return e.constructValue(f, val.(*ast.ParenExpr).X)
+	// this happens for constructs like:
+	//  gettext.Gettext(myConst)
+	case *ast.Ident, *ast.SelectorExpr:
+		if ident, ok := val.(*ast.Ident); ok {
+			if _, ok := e.locals[ident.Name]; ok {
+				return e.resolveLocal(f, ident.Name)
+			}
+		}
+		if asset, ok := e.embedAsset(f, val.(ast.Expr)); ok {
+			return embedValue(asset)
+		}
+		if info := e.typesInfo[f]; info != nil {
+			return typedConstValue(info, val.(ast.Expr))
+		}
+		// most likely a variable, only known at runtime
+		key := constKey(f, val.(ast.Expr))
+		if _, ok := e.consts[key]; !ok {
+			return "", &dynamicValueError{val.(ast.Expr), "unknown constant"}
+		}
+		return e.resolveConst(key)
+	// this happens for constructs like:
+	//  gettext.Gettext(fmt.Sprintf(gettext.Gettext("foo %s"), bar))
+	// the inner calls are inspected on their own
+	case *ast.CallExpr:
+		call := val.(*ast.CallExpr)
+		// conversions of constants, like string(ctxMenu) or
+		// Ctx("menu")
+		if info := e.typesInfo[f]; info != nil {
+			if value, err := typedConstValue(info, call); err == nil {
+				return value, nil
+			}
+		} else if len(call.Args) == 1 && e.isStringType(f, call.Fun) {
+			return e.constructValue(f, call.Args[0])
+		}
+		// this happens for constructs like:
+		//  gettext.Gettext(strings.Join([]string{"foo", "bar"}, "\n"))
+		if constKey(f, call.Fun) == "strings.Join" && len(call.Args) == 2 {
+			if value, err := e.joinValue(f, call); err == nil {
+				return value, nil
+			}
+		}
+		return "", &dynamicValueError{call, "value is computed by a call"}
+	default:
+		return "", fmt.Errorf("unknown type: %v", val)
+	}
+}
+
+// dynamicValueError is returned by constructValue for values that are
+// only known at runtime, like variables or the results of calls. These
+// are only reported with WarnDynamic as they often are intended, e.g.
+// to wrap a keyword call.
+type dynamicValueError struct {
+	expr   ast.Expr
+	reason string
+}
+
+func (err *dynamicValueError) Error() string {
+	return fmt.Sprintf("%s: %s", err.reason, types.ExprString(err.expr))
+}
+
+// argValue returns the value of the argument at idx of the call x
+func (e *Extractor) argValue(f *ast.File, x *ast.CallExpr, idx int) (string, error) {
+	if idx >= len(x.Args) {
+		return "", fmt.Errorf("missing argument %d", idx)
+	}
+	return e.constructValue(f, x.Args[idx])
+}
+
+// constDef is a package level constant and the file declaring it
+type constDef struct {
+	f     *ast.File
+	value ast.Expr
+}
+
+// collectConsts adds the package level constants of f to e.consts and
+// its string types to e.stringTypes, keyed by package name and name
+func (e *Extractor) collectConsts(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		// types like "type Ctx string" for the conversions of constants
+		if gen.Tok == token.TYPE {
+			for _, spec := range gen.Specs {
+				tspec := spec.(*ast.TypeSpec)
+				if ident, ok := tspec.Type.(*ast.Ident); ok && ident.Name == "string" {
+					e.stringTypes[f.Name.Name+"."+tspec.Name.Name] = true
+				}
+			}
+			continue
+		}
+		if gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vspec := spec.(*ast.ValueSpec)
+			// constants repeating the previous expression are
+			// iota based and never strings
+			for i, name := range vspec.Names {
+				if i < len(vspec.Values) {
+					e.consts[f.Name.Name+"."+name.Name] = constDef{f: f, value: vspec.Values[i]}
+				}
+			}
+		}
+	}
+}
+
+// isStringType returns whether expr is string or a type with string as
+// underlying type
+func (e *Extractor) isStringType(f *ast.File, expr ast.Expr) bool {
+	if ident, ok := expr.(*ast.Ident); ok && ident.Name == "string" {
+		return true
+	}
+	return e.stringTypes[constKey(f, expr)]
+}
+
+// joinValue returns the value of a strings.Join call over a slice
+// literal, the elements and the separator must have a known value
+func (e *Extractor) joinValue(f *ast.File, call *ast.CallExpr) (string, error) {
+	elems := call.Args[0]
+	if ident, ok := elems.(*ast.Ident); ok && e.locals[ident.Name] != nil {
+		elems = e.locals[ident.Name]
+	}
+	slice, ok := elems.(*ast.CompositeLit)
+	if !ok {
+		return "", fmt.Errorf("not a slice literal: %v", elems)
+	}
+	sep, err := e.joinElemValue(f, call.Args[1])
+	if err != nil {
+		return "", err
+	}
+	values := make([]string, 0, len(slice.Elts))
+	for _, elt := range slice.Elts {
+		value, err := e.joinElemValue(f, elt)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return strconv.Quote(strings.Join(values, sep)), nil
+}
+
+// joinElemValue returns the unquoted value of a strings.Join argument
+func (e *Extractor) joinElemValue(f *ast.File, expr ast.Expr) (string, error) {
+	value, err := e.constructValue(f, expr)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("not a string value: %v", expr)
+	}
+	return strconv.Unquote(value)
+}
+
+// constKey returns the e.consts key for an identifier or a qualified
+// identifier as used in f, packages are identified by their name only
+func constKey(f *ast.File, expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return f.Name.Name + "." + x.Name
+	case *ast.SelectorExpr:
+		if importPath := importPathOf(f, x.X); importPath != "" {
+			return defaultPackageName(importPath) + "." + x.Sel.Name
+		}
+	}
+	return ""
+}
+
+// collectLocals returns the variables of the function decl that are
+// assigned exactly once, by their definition, with the assigned values
+func collectLocals(decl *ast.FuncDecl) map[string]ast.Expr {
+	assigned := make(map[string]int)
+	values := make(map[string]ast.Expr)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Field:
+			// parameters and results
+			for _, name := range x.Names {
+				assigned[name.Name]++
+			}
+		case *ast.ValueSpec:
+			for i, name := range x.Names {
+				assigned[name.Name]++
+				if len(x.Values) == len(x.Names) {
+					values[name.Name] = x.Values[i]
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range x.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				assigned[ident.Name]++
+				if x.Tok == token.DEFINE && len(x.Lhs) == len(x.Rhs) {
+					values[ident.Name] = x.Rhs[i]
+				}
+			}
+		case *ast.RangeStmt:
+			for _, expr := range []ast.Expr{x.Key, x.Value} {
+				if ident, ok := expr.(*ast.Ident); ok {
+					assigned[ident.Name]++
+				}
+			}
+		case *ast.UnaryExpr:
+			// the variable may be modified through its address
+			if ident, ok := x.X.(*ast.Ident); ok && x.Op == token.AND {
+				assigned[ident.Name]++
+			}
+		}
+		return true
+	})
+
+	locals := make(map[string]ast.Expr)
+	for name, value := range values {
+		if assigned[name] == 1 {
+			locals[name] = value
+		}
+	}
+	return locals
+}
+
+func (e *Extractor) resolveLocal(f *ast.File, name string) (string, error) {
+	key := "local." + name
+	if e.resolving[key] {
+		return "", fmt.Errorf("variable loop: %s", name)
+	}
+	if lit, ok := e.locals[name].(*ast.BasicLit); ok && lit.Kind != token.STRING {
+		return "", fmt.Errorf("not a string variable: %s", name)
+	}
+	e.resolving[key] = true
+	defer delete(e.resolving, key)
+
+	return e.constructValue(f, e.locals[name])
+}
+
+func (e *Extractor) resolveConst(key string) (string, error) {
+	def, ok := e.consts[key]
+	if !ok {
+		return "", fmt.Errorf("unknown constant: %s", key)
+	}
+	// invalid Go, but must not make us loop forever
+	if e.resolving[key] {
+		return "", fmt.Errorf("constant loop: %s", key)
+	}
+	if lit, ok := def.value.(*ast.BasicLit); ok && lit.Kind != token.STRING {
+		return "", fmt.Errorf("not a string constant: %s", key)
+	}
+	e.resolving[key] = true
+	defer delete(e.resolving, key)
+
+	return e.constructValue(def.f, def.value)
+}
+
+// contextualKey joins msgctxt and msgid into a single key, as needed by
+// output formats without a separate notion of context
+func (e *Extractor) contextualKey(msgctxt, msgid string) string {
+	if msgctxt == "" {
+		return msgid
+	}
+	return msgctxt + e.ContextualKeySeparator + msgid
+}
+
+func parseFunExpr(path string, expr ast.Expr) string {
+	switch sel := expr.(type) {
+	case *ast.Ident:
+		if path != "" {
+			path = "." + path
+		}
+		return sel.Name + path
+	case *ast.SelectorExpr:
+		if path != "" {
+			path = "." + path
+		}
+		return parseFunExpr(sel.Sel.Name+path, sel.X)
+	}
+	return ""
+}
+
+// matches SQL comments like: -- i18n: "Column Header"
+var sqlCommentRe = regexp.MustCompile(`--\s*i18n:\s*"((?:[^"\\]|\\.)*)"`)
+
+func (e *Extractor) inspectSQLComments(fset *token.FileSet, lit *ast.BasicLit) {
+	posLit := fset.Position(lit.Pos())
+	for _, m := range sqlCommentRe.FindAllStringSubmatchIndex(lit.Value, -1) {
+		msgidStr := lit.Value[m[2]:m[3]]
+		if msgidStr == "" {
+			continue
+		}
+		// point to the line inside the (raw) string literal
+		line := posLit.Line + strings.Count(lit.Value[:m[0]], "\n")
+		column := posLit.Column + m[0]
+		if nl := strings.LastIndex(lit.Value[:m[0]], "\n"); nl >= 0 {
+			column = m[0] - nl
+		}
+		e.addMsgID(msgidStr, msgID{
+			msgctxt: e.domainContext("", ""),
+			fname:   posLit.Filename,
+			line:    line,
+			column:  column,
+			offset:  posLit.Offset + m[0],
+		})
+	}
+}
+
+// directivePrefix starts the comments controlling the extraction of
+// the code they apply to, e.g. // xgettext:extract
+const directivePrefix = "xgettext:"
+
+// msgctxtPrefix starts the comments giving the msgctxt of the keyword
+// calls they apply to, e.g. // msgctxt: menu
+const msgctxtPrefix = "msgctxt:"
+
+// directiveLines returns the text after prefix of the comments of f
+// starting with it, by the line they apply to: the line of the comment,
+// or the following line for comments on a line of their own
+func directiveLines(fset *token.FileSet, f *ast.File, prefix string) map[int]string {
+	// the first column with code of each line
+	codeColumns := make(map[int]int)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil, *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		pos := fset.Position(n.Pos())
+		if col, ok := codeColumns[pos.Line]; !ok || pos.Column < col {
+			codeColumns[pos.Line] = pos.Column
+		}
+		return true
+	})
+
+	directives := make(map[int]string)
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if !strings.HasPrefix(text, prefix) {
+				continue
+			}
+			pos := fset.Position(c.Pos())
+			line := pos.Line
+			if col, ok := codeColumns[line]; !ok || col > pos.Column {
+				line++
+			}
+			directives[line] = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+		}
+	}
+	return directives
+}
+
+// hasDirective returns true if the directive applies to the line of pos
+func (e *Extractor) hasDirective(pos token.Position, directive string) bool {
+	return e.directives[pos.Line] == directive
+}
+
+// inspectAnnotatedLiteral extracts all string literals of a composite
+// literal marked with // xgettext:extract, except map keys and those
+// passed to calls
+func (e *Extractor) inspectAnnotatedLiteral(fset *token.FileSet, f *ast.File, lit *ast.CompositeLit) {
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.CallExpr:
+			return false
+		case *ast.KeyValueExpr:
+			ast.Inspect(x.Value, inspect)
+			return false
+		case *ast.CompositeLit:
+			// nested literals marked on their own are inspected separately
+			return x == lit || !e.hasDirective(fset.Position(x.Pos()), "extract")
+		case *ast.BasicLit:
+			if x.Kind != token.STRING {
+				break
+			}
+			i18nStr, err := e.constructValue(f, x)
+			if err != nil || formatI18nStr(i18nStr) == "" {
+				break
+			}
+			posLit := fset.Position(x.Pos())
+			e.addMsgID(formatI18nStr(i18nStr), msgID{
+				msgctxt: e.domainContext("", ""),
+				fname:   posLit.Filename,
+				line:    posLit.Line,
+				column:  posLit.Column,
+				offset:  posLit.Offset,
+				comment: e.findCommentsForTranslation(fset, f, posLit),
+			})
+		}
+		return true
+	}
+	ast.Inspect(lit, inspect)
+}
+
+var cobraCommandFields = map[string]bool{
+	"Use":     true,
+	"Short":   true,
+	"Long":    true,
+	"Example": true,
+}
+
+func (e *Extractor) inspectCobraCommand(fset *token.FileSet, f *ast.File, lit *ast.CompositeLit) {
+	e.inspectStructFields(fset, f, lit, cobraCommandFields, nil, "#. (cobra command field: %s)\n")
+}
+
+// inspectStructFields extracts the literal values of fields in lit,
+// autoComment is formatted with the field name. A field of plurals
+// and its plural field given in the same literal form a single plural
+// entry.
+func (e *Extractor) inspectStructFields(fset *token.FileSet, f *ast.File, lit *ast.CompositeLit, fields map[string]bool, plurals map[string]string, autoComment string) {
+	values := make(map[string]string)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok || !fields[key.Name] {
+			continue
+		}
+		// non-literal values (e.g. keyword calls) are handled elsewhere
+		if i18nStr, err := e.constructValue(f, kv.Value); err == nil && i18nStr != "" {
+			values[key.Name] = i18nStr
+		}
+	}
+	pluralOf := make(map[string]bool)
+	for field, pluralField := range plurals {
+		if values[field] != "" && values[pluralField] != "" {
+			pluralOf[pluralField] = true
+		}
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok || values[key.Name] == "" || pluralOf[key.Name] {
+			continue
+		}
+		var msgidPlural string
+		if pluralField := plurals[key.Name]; pluralOf[pluralField] {
+			msgidPlural = formatI18nStr(values[pluralField])
+		}
+
+		posValue := fset.Position(kv.Value.Pos())
+		e.addMsgID(formatI18nStr(values[key.Name]), msgID{
+			msgidPlural: msgidPlural,
+			msgctxt:     e.domainContext("", ""),
+			fname:       posValue.Filename,
+			line:        posValue.Line,
+			column:      posValue.Column,
+			offset:      posValue.Offset,
+			comment:     e.findCommentsForTranslation(fset, f, fset.Position(kv.Pos())),
+			autoComment: fmt.Sprintf(autoComment, key.Name),
+		})
+	}
+}
+
+func (e *Extractor) warnPluralWithoutCount(fset *token.FileSet, x *ast.CallExpr, keyword *keywordDef) {
+	if keyword.Type != kTypePlural && keyword.Type != kTypePluralContextual && keyword.Type != kTypePluralDomain {
+		return
+	}
+	// the count follows the plural string
+	if len(x.Args) <= keyword.msgidPluralIdx()+1 {
+		pos := fset.Position(x.Pos())
+		e.warnf(pos, "plural-without-count", "Plural call without count argument at %s\n", pos)
+	}
+}
+
+// validateCall reports keyword calls with too few arguments and, with
+// type information, message arguments that are not strings and counts
+// that are not integers
+func (e *Extractor) validateCall(fset *token.FileSet, f *ast.File, x *ast.CallExpr, keyword *keywordDef) {
+	pos := fset.Position(x.Pos())
+	name := types.ExprString(x.Fun)
+
+	msgArgs := keyword.msgidIdxs(len(x.Args))
+	countArg := -1
+	switch keyword.Type {
+	case kTypePlural:
+		msgArgs = append(msgArgs, keyword.msgidPluralIdx())
+		countArg = keyword.msgidPluralIdx() + 1
+	case kTypeContextual:
+		msgArgs = append(msgArgs, keyword.msgctxtIdx())
+	case kTypePluralContextual:
+		msgArgs = append(msgArgs, keyword.msgctxtIdx(), keyword.msgidPluralIdx())
+		countArg = keyword.msgidPluralIdx() + 1
+	case kTypeDomain:
+		msgArgs = append(msgArgs, keyword.domainIdx())
+	case kTypePluralDomain:
+		msgArgs = append(msgArgs, keyword.domainIdx(), keyword.msgidPluralIdx())
+		countArg = keyword.msgidPluralIdx() + 1
+	}
+	want := countArg + 1
+	for _, idx := range msgArgs {
+		if idx+1 > want {
+			want = idx + 1
+		}
+	}
+	if len(x.Args) < want && !x.Ellipsis.IsValid() {
+		e.warnf(pos, "invalid-call", "Call of %s at %s has %d arguments, expected at least %d\n", name, pos, len(x.Args), want)
+		return
+	}
+
+	info := e.typesInfo[f]
+	if info == nil {
+		return
+	}
+	for _, idx := range msgArgs {
+		if t := info.TypeOf(x.Args[idx]); t != nil && !isBasicInfo(t, types.IsString) {
+			e.warnf(pos, "invalid-call", "Argument %d of %s at %s is %s, not a string\n", idx, name, pos, t)
+		}
+	}
+	if countArg >= 0 {
+		if t := info.TypeOf(x.Args[countArg]); t != nil && !isBasicInfo(t, types.IsInteger) {
+			e.warnf(pos, "invalid-call", "Argument %d of %s at %s is %s, not an integer\n", countArg, name, pos, t)
+		}
+	}
+}
+
+// isBasicInfo returns true if the underlying type of t is a basic type
+// with the given property
+func isBasicInfo(t types.Type, info types.BasicInfo) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&info != 0
+}
+
+func (e *Extractor) inspectGoGenerate(fset *token.FileSet, f *ast.File) {
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, "//go:generate ") {
+				continue
+			}
+			for _, m := range e.ExtractGoGenerate.FindAllStringSubmatch(c.Text, -1) {
+				msgidStr := m[0]
+				if len(m) > 1 {
+					msgidStr = m[1]
+				}
+				if msgidStr == "" {
+					continue
+				}
+				posComment := fset.Position(c.Pos())
+				e.addMsgID(msgidStr, msgID{
+					msgctxt: e.domainContext("", ""),
+					fname:   posComment.Filename,
+					line:    posComment.Line,
+					column:  posComment.Column,
+					offset:  posComment.Offset,
+				})
+			}
+		}
+	}
+}
+
+// matches a printf verb with its flags, width, precision and argument
+// index, e.g. %-5.2f or %[2]d, and the letter following it, if any
+var formatVerbRe = regexp.MustCompile(`%([-+# 0]*)(?:\[\d+\])?(?:\d+|\*)?(?:\.(?:\d+|\*)?)?(?:\[\d+\])?([a-zA-Z%])([a-zA-Z]?)`)
+
+// formatVerbMatches returns the printf verbs in s as matched by
+// formatVerbRe. A space flag directly followed by a verb that starts a
+// word, like in "50% off" or "100% sure", is prose and not a verb.
+func formatVerbMatches(s string) [][]string {
+	var matches [][]string
+	for _, m := range formatVerbRe.FindAllStringSubmatch(unescapeI18nStr(s), -1) {
+		if strings.HasSuffix(m[1], " ") && m[3] != "" {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// formatVerbs returns the sorted verbs of the format string s, %% is
+// not a verb
+func formatVerbs(s string) []string {
+	var verbs []string
+	for _, m := range formatVerbMatches(s) {
+		if m[2] != "%" {
+			verbs = append(verbs, m[2])
+		}
+	}
+	sort.Strings(verbs)
+	return verbs
+}
+
+// formatHints are the valid values of Extractor.FormatHint, auto picks
+// c-format or go-format depending on the verbs used
+var formatHints = map[string]bool{
+	"auto":      true,
+	"c-format":  true,
+	"go-format": true,
+	"no-hint":   true,
+}
+
+// the C99 conversion specifiers, any other verb is Go specific
+const cFormatVerbs = "diouxXfFeEgGaAcspn"
+
+// detectFormatHint returns go-format if the strings use Go specific
+// verbs or argument indexes, c-format if they only use verbs that are
+// valid in C too and "" if there are no verbs at all
+func detectFormatHint(strs ...string) string {
+	hint := ""
+	for _, s := range strs {
+		for _, m := range formatVerbMatches(s) {
+			if m[2] == "%" {
+				continue
+			}
+			if !strings.Contains(cFormatVerbs, m[2]) || strings.Contains(m[0], "[") {
+				return "go-format"
+			}
+			hint = "c-format"
+		}
+	}
+	return hint
+}
+
+func (e *Extractor) warnPluralFormatMismatch(fset *token.FileSet, x *ast.CallExpr, msgid, msgidPlural string) {
+	verbs, verbsPlural := formatVerbs(msgid), formatVerbs(msgidPlural)
+	if strings.Join(verbs, "") != strings.Join(verbsPlural, "") {
+		pos := fset.Position(x.Pos())
+		e.warnf(pos, "plural-format-mismatch", "Plural strings use different format verbs at %s: %q and %q\n", pos, msgid, msgidPlural)
+	}
+}
+
+// matches the pflag methods defining a flag, e.g. StringVarP
+var cobraFlagMethodRe = regexp.MustCompile(`^(Bool|BoolSlice|Count|Duration|Float32|Float64|IP|Int|Int8|Int16|Int32|Int64|IntSlice|String|StringArray|StringSlice|StringToString|Uint|Uint8|Uint16|Uint32|Uint64)(Var)?P?$`)
+
+func (e *Extractor) inspectCobraFlag(fset *token.FileSet, f *ast.File, x *ast.CallExpr) {
+	sel, ok := x.Fun.(*ast.SelectorExpr)
+	if !ok || !cobraFlagMethodRe.MatchString(sel.Sel.Name) || len(x.Args) < 2 {
+		return
+	}
+	// only cmd.Flags().Foo() and cmd.PersistentFlags().Foo()
+	recv, ok := sel.X.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	recvSel, ok := recv.Fun.(*ast.SelectorExpr)
+	if !ok || (recvSel.Sel.Name != "Flags" && recvSel.Sel.Name != "PersistentFlags") {
+		return
+	}
+
+	usage := x.Args[len(x.Args)-1]
+	i18nStr, err := e.constructValue(f, usage)
+	if err != nil || i18nStr == "" {
+		return
+	}
+	// the *Var variants take the destination pointer first
+	nameArg := x.Args[0]
+	if strings.Contains(sel.Sel.Name, "Var") {
+		nameArg = x.Args[1]
+	}
+	autoComment := "#. (cobra flag usage)\n"
+	if flagName, err := e.constructValue(f, nameArg); err == nil && flagName != "" {
+		autoComment = poComment("#.", fmt.Sprintf("(cobra flag usage: --%s)", unescapeI18nStr(formatI18nStr(flagName))))
+	}
+
+	posUsage := fset.Position(usage.Pos())
+	e.addMsgID(formatI18nStr(i18nStr), msgID{
+		msgctxt:     e.domainContext("", ""),
+		fname:       posUsage.Filename,
+		line:        posUsage.Line,
+		column:      posUsage.Column,
+		offset:      posUsage.Offset,
+		comment:     e.findCommentsForTranslation(fset, f, fset.Position(x.Pos())),
+		autoComment: autoComment,
+	})
+}
+
+func (e *Extractor) inspectNodeForTranslations(fset *token.FileSet, f *ast.File, n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.CompositeLit:
+		typeName := parseFunExpr("", x.Type)
+		if e.ExtractCobra && typeName == "cobra.Command" {
+			e.inspectCobraCommand(fset, f, x)
+		}
+		if fields, ok := e.KeywordFields[typeName]; ok {
+			e.inspectStructFields(fset, f, x, fields, e.PluralFields[typeName], "#. (struct field: "+typeName+".%s)\n")
+		}
+		if e.hasDirective(fset.Position(x.Pos()), "extract") {
+			e.inspectAnnotatedLiteral(fset, f, x)
+		}
+	case *ast.BasicLit:
+		if e.ExtractSQLComment && x.Kind == token.STRING {
+			e.inspectSQLComments(fset, x)
+		}
+	case *ast.CallExpr:
+		if e.ExtractCobraFlags {
+			e.inspectCobraFlag(fset, f, x)
+		}
+
+		keyword, ok := e.lookupKeyword(f, x.Fun)
+		if !ok && e.TrackFuncValues {
+			if _, isIdent := x.Fun.(*ast.Ident); isIdent {
+				keyword = e.funcValueKeyword(f, x.Fun, e.locals, e.funcValues)
+				ok = keyword != nil
+			}
+		}
+		if !ok {
+			break
+		}
+		// the arguments are the parameters of the wrapper
+		if e.wrapperCalls[x] {
+			break
+		}
+		if e.hasDirective(fset.Position(x.Pos()), "ignore") {
+			e.suppressed++
+			break
+		}
+		if e.WarnPluralWithoutN {
+			e.warnPluralWithoutCount(fset, x, keyword)
+		}
+		if e.ValidateCalls {
+			e.validateCall(fset, f, x, keyword)
+		}
+		for _, msgidIdx := range keyword.msgidIdxs(len(x.Args)) {
+			e.inspectKeywordCall(fset, f, x, keyword, msgidIdx)
+		}
+	}
+
+	return true
+}
+
+// inspectKeywordCall adds the msgid at msgidIdx of the keyword call x,
+// with the other strings the keyword takes
+func (e *Extractor) inspectKeywordCall(fset *token.FileSet, f *ast.File, x *ast.CallExpr, keyword *keywordDef, msgidIdx int) {
+	var i18nStr, i18nStrPlural, i18nCtxt, i18nDomain string
+	var err error
+	switch keyword.Type {
+	case kTypeSingular:
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+	case kTypePlural:
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+		if err != nil {
+			break
+		}
+		i18nStrPlural, err = e.argValue(f, x, keyword.msgidPluralIdx())
+	case kTypeContextual:
+		i18nCtxt, err = e.argValue(f, x, keyword.msgctxtIdx())
+		if err != nil {
+			break
+		}
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+	case kTypePluralContextual:
+		i18nCtxt, err = e.argValue(f, x, keyword.msgctxtIdx())
+		if err != nil {
+			break
+		}
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+		if err != nil {
+			break
+		}
+		i18nStrPlural, err = e.argValue(f, x, keyword.msgidPluralIdx())
+	case kTypeDomain:
+		i18nDomain, err = e.argValue(f, x, keyword.domainIdx())
+		if err != nil {
+			break
+		}
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+	case kTypePluralDomain:
+		i18nDomain, err = e.argValue(f, x, keyword.domainIdx())
+		if err != nil {
+			break
+		}
+		i18nStr, err = e.argValue(f, x, msgidIdx)
+		if err != nil {
+			break
+		}
+		i18nStrPlural, err = e.argValue(f, x, keyword.msgidPluralIdx())
+	}
+	if _, ok := err.(*dynamicValueError); ok {
+		pos := fset.Position(x.Pos())
+		if e.WarnDynamic {
+			e.warnf(pos, "dynamic-value", "Dynamic message argument at %s: %v\n", pos, err)
+		} else if e.Verbose {
+			e.notef(pos, "dynamic-value", "Skipping %s: %v\n", pos, err)
+		}
+		return
+	}
+	if err == nil && i18nCtxt == "" {
+		if msgctxt, ok := e.contextComments[fset.Position(x.Pos()).Line]; ok {
+			i18nCtxt = strconv.Quote(msgctxt)
+		}
+	}
+	if err != nil {
+		pos := fset.Position(x.Pos())
+		e.warnf(pos, "unresolved-value", "Unable to obtain value at %s: %v\n", pos, err)
+		return
+	}
+
+	if i18nStr == "" {
+		return
+	}
+	if formatI18nStr(i18nStr) == "" {
+		pos := fset.Position(x.Pos())
+		e.warnf(pos, "empty-msgid", "Empty msgid at %s, it is reserved for the header\n", pos)
+		return
+	}
+	if e.WarnPluralFormat && i18nStrPlural != "" {
+		e.warnPluralFormatMismatch(fset, x, formatI18nStr(i18nStr), formatI18nStr(i18nStrPlural))
+	}
+
+	formatHint := detectFormatHint(formatI18nStr(i18nStr), formatI18nStr(i18nStrPlural))
+	switch e.FormatHint {
+	case "", "auto":
+	case "no-hint":
+		formatHint = ""
+	default:
+		if formatHint != "" {
+			formatHint = e.FormatHint
+		}
+	}
+	switch keyword.Format {
+	case "", "auto":
+	case "no-format":
+		// a literal % that msgfmt must not check
+		formatHint = "no-c-format"
+	default:
+		formatHint = keyword.Format
+	}
+
+	// the domain argument takes precedence over the keyword domain
+	domain := keyword.Domain
+	if i18nDomain != "" {
+		domain = formatI18nStr(i18nDomain)
+	}
+
+	posCall := fset.Position(x.Pos())
+	m := msgID{
+		formatHint:  formatHint,
+		msgidPlural: formatI18nStr(i18nStrPlural),
+		msgctxt:     e.domainContext(domain, formatI18nStr(i18nCtxt)),
+		fname:       posCall.Filename,
+		line:        posCall.Line,
+		column:      posCall.Column,
+		offset:      posCall.Offset,
+		comment:     e.findCommentsForTranslation(fset, f, posCall),
+		domain:      domain,
+	}
+	if keyword.AutoComment != "" {
+		m.autoComment = formatComment(keyword.AutoComment)
+	}
+	if m.domain == "" {
+		m.domain = e.Domain
+	}
+	msgidArg := x.Args[msgidIdx]
+	if e.LiteralLocation {
+		m.literalLine = fset.Position(msgidArg.Pos()).Line
+	}
+	if e.LocationEndLine {
+		m.endLine = fset.Position(msgidArg.End()).Line
+	}
+	// the text lives in the embedded file, not in the call
+	if asset, ok := e.embedAsset(f, msgidArg); ok {
+		m.fname, m.line, m.column, m.offset = asset, 1, 0, 0
+		m.literalLine, m.endLine = 0, 0
+	}
+	e.addMsgID(formatI18nStr(i18nStr), m)
+}
+
+// formatI18nStr turns a Go string literal into its PO representation,
+// as stored in msgIDs
+func formatI18nStr(s string) string {
+	if s == "" {
+		return ""
+	}
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		// not a valid literal, strip leading and trailing " (or `)
+		return poEscape(s[1 : len(s)-1])
+	}
+	return poEscape(value)
+}
+
+// poEscape escapes s for a double quoted PO string, using only the
+// escape sequences understood by GNU msgfmt. Other bytes, including
+// non-ASCII UTF-8, are written unchanged.
+func poEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&buf, "\\%03o", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// poComment returns the comment lines of text starting with prefix,
+// e.g. "#.". Comments are not escaped, text is split at line breaks
+// instead so it cannot end the comment early.
+func poComment(prefix, text string) string {
+	out := ""
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		out += prefix + " " + line + "\n"
+	}
+	return out
+}
+
+// unescapeI18nStr turns a string as stored in msgIDs back into the
+// text it represents
+func unescapeI18nStr(s string) string {
+	unquoted, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil {
+		return s
+	}
+	return unquoted
+}
+
+// Extract goes over the given source files and collects their
+// translatable strings, replacing the result of any previous call
+func (e *Extractor) Extract(files []string) error {
+	e.msgIDs = make(map[string][]msgID)
+	e.obsoleteMsgIDs = make(map[string][]msgID)
+	e.processedFiles = nil
+	e.failedFiles = nil
+	e.suppressed = 0
+	e.wrappers = make(keywords)
+	e.wrapperCalls = make(map[*ast.CallExpr]bool)
+	e.consts = make(map[string]constDef)
+	e.stringTypes = make(map[string]bool)
+	e.embeds = make(map[string]string)
+	e.resolving = make(map[string]bool)
+	e.typesInfo = make(map[*ast.File]*types.Info)
+	e.constraints = make(map[string]string)
+	patterns, err := compileKeywordPatterns(e.Keywords)
+	if err != nil {
+		return err
+	}
+	e.patterns = patterns
+
+	var candidates []string
+	for _, fname := range files {
+		if e.SkipTests && strings.HasSuffix(fname, "_test.go") {
+			e.warnf(token.Position{Filename: fname}, "test-file", "Skipping test file %s\n", fname)
+			continue
+		}
+		if e.BuildContext != nil {
+			match, err := matchBuildContext(e.BuildContext, fname)
+			if err != nil {
+				return err
+			}
+			if !match {
+				if e.Verbose {
+					e.notef(token.Position{Filename: fname}, "build-constraints", "Skipping %s, excluded by build constraints\n", fname)
+				}
+				continue
+			}
+		}
+		candidates = append(candidates, fname)
+	}
+
+	fset := token.NewFileSet()
+	var loaded map[string]*ast.File
+	if e.TypeCheck {
+		var err error
+		loaded, err = e.loadPackages(fset, candidates)
+		if err != nil {
+			return err
+		}
+	}
+
+	var parsed []*ast.File
+	for _, fname := range candidates {
+		var f *ast.File
+		var err error
+		if loaded[fname] != nil {
+			f = loaded[fname]
+		} else {
+			// e.g. cgo files, the loaded syntax is the generated code
+			if loaded != nil && e.Verbose {
+				e.notef(token.Position{Filename: fname}, "no-type-info", "No type information for %s\n", fname)
+			}
+			f, err = e.parseGoSource(fset, fname)
+		}
+		if err != nil && e.ContinueOnError {
+			e.warnf(token.Position{Filename: fname}, "skipped-file", "Skipping %s: %v\n", fname, err)
+			e.failedFiles = append(e.failedFiles, fname)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		e.processedFiles = append(e.processedFiles, fname)
+		e.collectConsts(f)
+		if e.ExtractEmbed {
+			e.collectEmbeds(fset, f)
+		}
+		parsed = append(parsed, f)
+	}
+
+	if e.AutoKeywords {
+		e.discoverWrappers(fset, parsed)
+	}
+
+	// only now all constants are known
+	for _, f := range parsed {
+		e.processSingleGoSource(fset, f)
+	}
+	mergePlurals(e.msgIDs)
+
+	return nil
+}
+
+// matchBuildContext returns true if fname would be compiled in ctxt
+func matchBuildContext(ctxt *build.Context, fname string) (bool, error) {
+	dir, base := filepath.Split(fname)
+	if dir == "" {
+		dir = "."
+	}
+	return ctxt.MatchFile(dir, base)
+}
+
+// knownOS and knownArch are the GOOS and GOARCH values recognized in
+// file name suffixes, see go/build
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+	"js": true, "linux": true, "nacl": true, "netbsd": true,
+	"openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true,
+	"armbe": true, "arm64": true, "arm64be": true, "loong64": true,
+	"mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+	"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+	"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
+
+// buildConstraint describes the build constraints of f, from its
+// file name and its //go:build line, or returns "" if it is always built
+func buildConstraint(fname string, f *ast.File) string {
+	var parts []string
+
+	name := strings.TrimSuffix(filepath.Base(fname), ".go")
+	name = strings.TrimSuffix(name, "_test")
+	elems := strings.Split(name, "_")
+	if n := len(elems); n >= 3 && knownOS[elems[n-2]] && knownArch[elems[n-1]] {
+		parts = append(parts, elems[n-2], elems[n-1])
+	} else if n >= 2 && (knownOS[elems[n-1]] || knownArch[elems[n-1]]) {
+		parts = append(parts, elems[n-1])
+	}
+
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				continue
+			}
+			s := expr.String()
+			if len(parts) > 0 {
+				if _, ok := expr.(*constraint.OrExpr); ok {
+					s = "(" + s + ")"
+				}
+			}
+			parts = append(parts, s)
+		}
+	}
+
+	return strings.Join(parts, " && ")
+}
+
+// mergePlurals gives the singular occurrences of a msgid also used
+// with a plural the msgid_plural of the first plural occurrence, like
+// GNU xgettext does. Differing plurals are left to validateMsgIDs.
+func mergePlurals(msgIDs map[string][]msgID) {
+	for _, msgidList := range msgIDs {
+		var plural string
+		for _, m := range msgidList {
+			if m.msgidPlural != "" {
+				plural = m.msgidPlural
+				break
+			}
+		}
+		if plural == "" {
+			continue
+		}
+		for i := range msgidList {
+			if msgidList[i].msgidPlural == "" {
+				msgidList[i].msgidPlural = plural
+			}
+		}
+	}
+}
+
+// validateMsgIDs reports the msgids used with several msgctxt, each
+// of them becomes an entry of its own, and the msgids whose occurrences
+// disagree on their msgid_plural, only the first one would be written
+func validateMsgIDs(msgIDs map[string][]msgID) []string {
+	// the keys of msgIDs include the msgctxt
+	keysByMsgid := make(map[string][]string)
+	for k := range msgIDs {
+		msgid := msgidFromKey(k)
+		keysByMsgid[msgid] = append(keysByMsgid[msgid], k)
+	}
+	var msgids []string
+	for msgid := range keysByMsgid {
+		msgids = append(msgids, msgid)
+	}
+	sort.Strings(msgids)
+
+	var diags []string
+	for _, msgid := range msgids {
+		keys := keysByMsgid[msgid]
+		sort.Strings(keys)
+		first := msgIDs[keys[0]][0]
+		for _, k := range keys[1:] {
+			m := msgIDs[k][0]
+			diags = append(diags, fmt.Sprintf("msgid %q has conflicting msgctxt %q at %s:%d and %q at %s:%d", msgid, first.msgctxt, first.fname, first.line, m.msgctxt, m.fname, m.line))
+		}
+		for _, k := range keys {
+			first := msgIDs[k][0]
+			for _, m := range msgIDs[k][1:] {
+				if m.msgidPlural != first.msgidPlural {
+					diags = append(diags, fmt.Sprintf("msgid %q has conflicting msgid_plural %q at %s:%d and %q at %s:%d", msgid, first.msgidPlural, first.fname, first.line, m.msgidPlural, m.fname, m.line))
+				}
+			}
+		}
+	}
+	return diags
+}
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+func (e *Extractor) parseGoSource(fset *token.FileSet, fname string) (*ast.File, error) {
+	fnameContent, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(fnameContent, []byte(utf8BOM)) {
+		if e.Verbose {
+			e.notef(token.Position{Filename: fname}, "bom", "Stripped UTF-8 byte order mark from %s\n", fname)
+		}
+		fnameContent = fnameContent[len(utf8BOM):]
+	}
+
+	// Create the AST by parsing src.
+	f, err := parser.ParseFile(fset, fname, fnameContent, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (e *Extractor) processSingleGoSource(fset *token.FileSet, f *ast.File) {
+	if e.AllPlatforms {
+		fname := fset.Position(f.Pos()).Filename
+		e.constraints[fname] = buildConstraint(fname, f)
+	}
+
+	e.directives = directiveLines(fset, f, directivePrefix)
+	e.contextComments = directiveLines(fset, f, msgctxtPrefix)
+
+	var funcValues map[*ast.FuncDecl]map[string]*keywordDef
+	if e.TrackFuncValues {
+		funcValues = e.collectFuncValues(fset, f)
+	}
+
+	for _, decl := range f.Decls {
+		e.locals = nil
+		e.funcValues = nil
+		if fdecl, ok := decl.(*ast.FuncDecl); ok {
+			e.locals = collectLocals(fdecl)
+			e.funcValues = funcValues[fdecl]
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			return e.inspectNodeForTranslations(fset, f, n)
+		})
+	}
+	e.locals = nil
+	e.funcValues = nil
+
+	if e.ExtractGoGenerate != nil {
+		e.inspectGoGenerate(fset, f)
+	}
+}
@@ -0,0 +1,144 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// collectFuncValues finds the parameters of the functions of f that
+// are passed keywords as function values, e.g. t in
+//
+//	func render(tmpl string, t func(string) string) { t("Hello") }
+//	render(tmpl, i18n.G)
+//
+// and returns them by function and parameter name. Only calls of the
+// functions of f by their name are followed.
+func (e *Extractor) collectFuncValues(fset *token.FileSet, f *ast.File) map[*ast.FuncDecl]map[string]*keywordDef {
+	var fdecls []*ast.FuncDecl
+	funcs := make(map[string]*ast.FuncDecl)
+	locals := make(map[*ast.FuncDecl]map[string]ast.Expr)
+	for _, decl := range f.Decls {
+		if fdecl, ok := decl.(*ast.FuncDecl); ok {
+			if fdecl.Recv == nil {
+				funcs[fdecl.Name.Name] = fdecl
+			}
+			fdecls = append(fdecls, fdecl)
+			locals[fdecl] = collectLocals(fdecl)
+		}
+	}
+
+	params := make(map[*ast.FuncDecl]map[string]*keywordDef)
+	// parameters passed on to other functions are found in the
+	// following rounds
+	for found := true; found; {
+		found = false
+		for _, fdecl := range fdecls {
+			ast.Inspect(fdecl, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				ident, ok := call.Fun.(*ast.Ident)
+				if !ok || funcs[ident.Name] == nil {
+					return true
+				}
+				callee := funcs[ident.Name]
+				names := paramNames(callee)
+				for i, arg := range call.Args {
+					if i >= len(names) || names[i] == "" {
+						break
+					}
+					keyword := e.funcValueKeyword(f, arg, locals[fdecl], params[fdecl])
+					if keyword == nil || params[callee][names[i]] != nil {
+						continue
+					}
+					if params[callee] == nil {
+						params[callee] = make(map[string]*keywordDef)
+					}
+					params[callee][names[i]] = keyword
+					found = true
+					if e.Verbose {
+						pos := fset.Position(call.Pos())
+						e.notef(pos, "func-value", "Using parameter %s of %s as keyword, it is passed %s\n", names[i], callee.Name.Name, keyword.Name)
+					}
+				}
+				return true
+			})
+		}
+	}
+	return params
+}
+
+// paramNames returns the parameter names of fdecl by position, with ""
+// for unnamed ones and without the variadic parameter
+func paramNames(fdecl *ast.FuncDecl) []string {
+	var names []string
+	for _, field := range fdecl.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			break
+		}
+		if len(field.Names) == 0 {
+			names = append(names, "")
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// funcValueKeyword returns the keyword the function value expr refers
+// to, directly like i18n.G or through the locals and the params of the
+// function it is used in, or nil
+func (e *Extractor) funcValueKeyword(f *ast.File, expr ast.Expr, locals map[string]ast.Expr, params map[string]*keywordDef) *keywordDef {
+	for seen := make(map[string]bool); ; {
+		ident, ok := expr.(*ast.Ident)
+		if !ok || seen[ident.Name] {
+			break
+		}
+		seen[ident.Name] = true
+		if keyword := params[ident.Name]; keyword != nil {
+			return keyword
+		}
+		value, ok := locals[ident.Name]
+		if !ok {
+			break
+		}
+		expr = value
+	}
+	// the result of a call is not a function value we know of
+	if _, ok := expr.(*ast.CallExpr); ok {
+		return nil
+	}
+	keyword, ok := e.lookupKeyword(f, expr)
+	if !ok {
+		return nil
+	}
+	return keyword
+}
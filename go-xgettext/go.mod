@@ -0,0 +1,18 @@
+module github.com/gosexy/gettext/go-xgettext
+
+go 1.25.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/tools v0.47.0
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/kr/pretty v0.3.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/rogpeppe/go-internal v1.6.1 // indirect
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
+)
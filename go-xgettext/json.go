@@ -0,0 +1,79 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonLocation struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+type jsonMessage struct {
+	// Key identifies the entry by msgctxt and msgid joined with the
+	// ContextualKeySeparator, like JavaScript gettext libraries do
+	Key         string         `json:"key"`
+	Msgctxt     string         `json:"msgctxt,omitempty"`
+	Msgid       string         `json:"msgid"`
+	MsgidPlural string         `json:"msgid_plural,omitempty"`
+	Comments    []string       `json:"comments,omitempty"`
+	Locations   []jsonLocation `json:"locations,omitempty"`
+	Format      string         `json:"format,omitempty"`
+}
+
+// WriteJSON writes the strings as a JSON array for other tools to
+// consume, the strings are unescaped
+func (e *Extractor) WriteJSON(w io.Writer) error {
+	msgs := []jsonMessage{}
+	for _, k := range e.sortedMsgIDKeys() {
+		msgidList := e.msgIDs[k]
+		msgid := msgidList[0]
+		msg := jsonMessage{
+			Key:         e.contextualKey(unescapeI18nStr(msgid.msgctxt), unescapeI18nStr(msgidFromKey(k))),
+			Msgctxt:     unescapeI18nStr(msgid.msgctxt),
+			Msgid:       unescapeI18nStr(msgidFromKey(k)),
+			MsgidPlural: unescapeI18nStr(msgid.msgidPlural),
+		}
+		msg.Format = entryFormatHint(msgidList)
+		for _, comment := range e.entryComments(msgidList) {
+			msg.Comments = append(msg.Comments, extractedComments(comment)...)
+		}
+		for _, m := range e.entryLocations(msgidList) {
+			msg.Locations = append(msg.Locations, jsonLocation{File: m.fname, Line: m.line, Column: m.column, Offset: m.offset})
+		}
+		msgs = append(msgs, msg)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(msgs)
+}
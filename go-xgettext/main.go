@@ -27,411 +27,1389 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"go/ast"
-	"go/parser"
+	"go/build"
 	"go/token"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 var (
+	verbose          = flag.Bool("verbose", false, "Print notes about the processed files.")
 	output           = flag.String("output", "", "Output to specified file.")
+	outputFormat     = stringList{}
+	outputBOM        = flag.Bool("output-bom", false, "Write a UTF-8 byte order mark at the start of the output file (never written to stdout).")
+	noOutputBOM      = flag.Bool("no-output-bom", false, "Never write a UTF-8 byte order mark, overrides --output-bom.")
 	addComments      = flag.Bool("add-comments", false, "Place all comment blocks preceding keyword lines in output file.")
-	addCommentsTag   = flag.String("add-comments-tag", "", "Place comment blocks starting with TAG and preceding keyword lines in output file.")
-	sortOutput       = flag.Bool("sort-output", false, "Generate sorted output.")
-	noLocation       = flag.Bool("no-location", false, "Do not write '#: filename:line' lines.")
+	maxCommentLines  = flag.Int("max-comment-lines", 20, "Maximum number of comment lines placed in output file per keyword line, 0 for no limit.")
+	sortOutput       = flag.Bool("sort-output", false, "Generate sorted output, same as --sort-output-by=msgid.")
+	sortByFile       = flag.Bool("sort-by-file", false, "Sort output by the first location of each entry, same as --sort-output-by=file.")
+	sortOutputBy     = flag.String("sort-output-by", "", "Sort output by one of: msgid, context, file, occurrence.")
+	addLocation      = flag.String("add-location", locationFull, "Write the locations of the strings in '#:' lines as filename:line (full), as filename only (file) or not at all (never).")
+	noLocation       = flag.Bool("no-location", false, "Deprecated, use --add-location=never. Do not write '#: filename:line' lines.")
+	width            = flag.Int("width", 0, "Write the strings in the GNU xgettext layout and wrap them at this column, e.g. 79 like GNU does. 0 keeps the default layout splitting strings after \\n only.")
+	noWrap           = flag.Bool("no-wrap", false, "Write the strings in the GNU xgettext layout without wrapping long lines, strings are still split after \\n.")
+	stripFilePrefix  = flag.String("strip-file-prefix", "", "Remove PREFIX from the file names in '#: filename:line' lines.")
+	relativeTo       = flag.String("relative-to", "", "Write the file names in '#: filename:line' lines relative to DIR, overrides --strip-file-prefix.")
 	msgIDBugsAddress = flag.String("msgid-bugs-address", "EMAIL", "set report address for msgid bugs.")
 	packageName      = flag.String("package-name", "", "Set package name in output.")
+	packageVersion   = flag.String("package-version", "", "Set the package version of the Project-Id-Version header field in output.")
+	headerFields     = stringList{}
+	copyrightHolder  = flag.String("copyright-holder", "", "Set the copyright holder in output.")
+	foreignUser      = flag.Bool("foreign-user", false, "Write a public domain notice instead of the copyright lines in output, like GNU xgettext.")
+	copyrightYear    = flag.Int("copyright-year", 0, "Set the copyright year in output, defaults to the current year when --copyright-holder is given.")
+	charset          = flag.String("charset", "UTF-8", "Set the charset of the Content-Type header field in output.")
+	omitHeader       = flag.Bool("omit-header", false, "Do not write the header entry, e.g. for fragments merged by other tools. Without any strings the output file is empty.")
+	noFuzzy          = flag.Bool("no-fuzzy", false, "Do not mark the header entry as fuzzy, for downstream tools that wrongly reject fuzzy POT headers.")
+	language         = flag.String("language", "", "Set the Language header field in output.")
+	languageTeam     = flag.String("language-team", "", "Set the Language-Team header field in output, defaults to '<language> <translation-url>' when --language is given.")
+	translationURL   = flag.String("translation-url", "", "Set the URL of the translation team used for the default Language-Team header field.")
 
-	keyword                 = flag.String("keyword", "gettext.Gettext", "Look for WORD as the keyword for singular strings.")
-	keywordPlural           = flag.String("keyword-plural", "gettext.NGettext", "Look for WORD as the keyword for plural strings.")
-	keywordContextual       = flag.String("keyword-contextual", "gettext.CGettext", "Look for WORD as the keyword for contextual strings.")
-	keywordPluralContextual = flag.String("keyword-plural-contextual", "gettext.CNGettext", "Look for WORD as the keyword for plural contextual strings.")
+	pluralFormsSlots       = flag.Int("plural-forms", 2, "Number of msgstr[N] lines written for plural entries, other values than 2 add a Plural-Forms header.")
+	pluralFormula          = flag.String("plural-formula", "", "Write FORMULA like 'nplurals=3; plural=...;' as the Plural-Forms header, its nplurals is the default for --plural-forms.")
+	addPluralFormsComment  = flag.Bool("add-plural-forms-comment", false, "Add a comment with the Plural-Forms of --language to plural entries.")
+	addMetadata            = flag.Bool("add-metadata", false, "Add comments with the date the file was added and the date and author of the last change of the line according to git to each entry.")
+	creationDate           = flag.String("creation-date", "", "Set the POT-Creation-Date header to DATE, like 2006-01-02 15:04-0700 or in RFC 3339 format, instead of the current time. The SOURCE_DATE_EPOCH environment variable is used when not given.")
+	onlyIfChanged          = flag.Bool("only-if-changed", false, "Leave an existing output file untouched when only its POT-Creation-Date header would change, so make rules depending on it are not triggered.")
+	noDate                 = flag.Bool("no-date", false, "Do not write the POT-Creation-Date header, for reproducible output.")
+	potRevisionDate        = flag.Bool("pot-revision-date", false, "Set PO-Revision-Date header to the current time.")
+	potRevisionDateFromGit = flag.Bool("pot-revision-date-from-git", false, "Set PO-Revision-Date header to the most recent git commit time of the processed files.")
 
-	skipArgs = flag.Int("skip-args", 0, "Number of arguments to skip in gettext function call before considering a text message argument.")
+	keywordPlural           = flag.String("keyword-plural", "", "Deprecated, use --keyword=WORD:1,2. Look for WORD as the keyword for plural strings.")
+	keywordContextual       = flag.String("keyword-contextual", "", "Deprecated, use --keyword=WORD:1c,2. Look for WORD as the keyword for contextual strings.")
+	keywordPluralContextual = flag.String("keyword-plural-contextual", "", "Deprecated, use --keyword=WORD:1c,2,3. Look for WORD as the keyword for plural contextual strings.")
+	keywordBare             = flag.String("keyword-bare", "", "Look for unqualified calls of WORD as the keyword for singular strings, e.g. _ for _(\"text\").")
+	keywordFormat           = flag.String("keyword-format", "", "Look for WORD as the keyword for singular format strings, these always get the go-format hint.")
 
-	keywordCfg = flag.String("keyword-cfg", "", "Path to keywords configuration file in JSON format. When given --keyword and --keywordPlural are ignored.")
-)
+	keywordSpecs         = stringList{}
+	noDefaultKeywords    = flag.Bool("no-default-keywords", false, "Do not look for the default keywords gettext.Gettext, gettext.NGettext:1,2 and gettext.CGettext:1c,2, only for the ones given by --keyword, --preset and the other keyword options. Same as an empty --keyword value.")
+	keywordCfgs          = stringList{}
+	presets              = stringList{}
+	keywordImportAliases = stringList{}
+	keywordArities       = stringList{}
+	keywordFields        = stringList{}
+
+	ignoreErrorsIn = stringList{}
+
+	addCommentsTags = stringList{}
+
+	referencePrefixStrip = stringList{}
+	referencePrefixMap   = stringList{}
+
+	splitByDomain = flag.Bool("split-by-domain", false, "Write one DOMAIN.pot file per domain into the directory of --output (default the current directory) instead of a single catalog, strings without domain go to messages.pot.")
+
+	joinExisting = flag.Bool("join-existing", false, "Join the extracted strings with the existing --output file, keeping translator comments and fuzzy marks.")
+	keepObsolete = flag.Bool("keep-obsolete", false, "With --join-existing, keep entries no longer found in the source as obsolete (#~) entries.")
+
+	filesFrom = ""
+
+	recursive    = false
+	includeTests = flag.Bool("include-tests", false, "Also process the _test.go files of directory arguments, their strings are marked with a \"(test file)\" comment.")
+	includes     = stringList{}
+	excludes     = stringList{}
+
+	domain            = flag.String("domain", "", "Set the domain of the extracted strings, keywords from --keyword-cfg can override it with their \"domain\" field.")
+	msgidDomainPrefix = flag.Bool("msgid-domain-prefix", false, "Prefix the msgctxt of each entry with its domain so the same msgid in different domains gives separate entries.")
+
+	formatHint = flag.String("format-hint", "auto", "Flag for strings with format verbs, one of: auto, c-format, go-format, no-hint. auto uses go-format for Go specific verbs like %v and c-format otherwise.")
+
+	contextualKeySeparator = flag.String("contextual-key-separator", `\u0004`, "Separator between msgctxt and msgid in the \"key\" of the JSON output, Go escape sequences are supported.")
+
+	warnPluralWithoutN = flag.Bool("warn-plural-without-n", false, "Warn about plural keyword calls that are missing the count argument.")
+	validateCalls      = flag.Bool("validate-calls", false, "Warn about keyword calls with fewer arguments than the keyword definition needs and, with --type-check, with message arguments that are not strings or counts that are not integers.")
+	warnDynamic        = flag.Bool("warn-dynamic", false, "Warn about keyword calls whose message arguments are only known at runtime, e.g. variables or the result of fmt.Sprintf.")
+	warnPluralFormat   = flag.Bool("warn-plural-format", false, "Warn about plural keyword calls whose singular and plural strings use different format verbs.")
+
+	buildTags = flag.String("tags", "", "Comma separated build tags, with --goos and --goarch only files matching the build constraints are processed.")
+	goos      = flag.String("goos", "", "Only process files built for this GOOS, defaults to the current one when --tags or --goarch is given.")
+	goarch    = flag.String("goarch", "", "Only process files built for this GOARCH, defaults to the current one when --tags or --goos is given.")
+
+	noAutoKeywords  = flag.Bool("no-auto-keywords", false, "Do not treat functions that only return a keyword call with their parameters, like func G(s string) string { return gettext.Gettext(s) }, as keywords.")
+	trackFuncValues = flag.Bool("track-func-values", false, "Best effort: treat calls of local variables and parameters that are assigned or passed a keyword function value, like t in render(tmpl, i18n.G), as keyword calls. Only functions called by name in the same file are followed.")
+
+	literalLocation = flag.Bool("literal-location", false, "Also reference the line of the msgid literal when it is not on the line of the keyword call.")
+	locationEndLine = flag.Bool("location-end-line", false, "Also reference the last line of msgid literals spanning multiple lines.")
+	locationColumns = flag.Bool("location-columns", false, "Write file:line:col references instead of the GNU file:line ones.")
+
+	allPlatforms = flag.Bool("all-platforms", false, "Process the files of all GOOS, GOARCH and build tag variants and mark the strings of platform specific files with a \"(build constraint: ...)\" comment.")
+
+	diagnosticsFormat = flag.String("diagnostics", "text", "Format of the WARN: and NOTE: diagnostics, \"text\" or \"json\" for one JSON object per line with file, line, column, severity, code and message.")
+	diagnosticsOutput = flag.String("diagnostics-output", "", "Write the diagnostics to this file instead of stderr.")
+
+	skipTests       = flag.Bool("skip-tests", false, "Do not extract strings from _test.go files.")
+	strict          = flag.Bool("strict", false, "Fail on msgids used with several msgctxt or msgid_plural values instead of only warning about them.")
+	continueOnError = flag.Bool("continue-on-error", false, "Report files that cannot be read or parsed and skip them instead of aborting.")
+	keepGoing       = flag.Bool("keep-going", false, "Like --continue-on-error, but exit with a non-zero status after writing the output if any file was skipped.")
+	typeCheck       = flag.Bool("type-check", false, "Load the input files as Go packages and match keywords by the called function (import path or package name), following import aliases, dot imports and shadowing. Methods can be given as keywords like (*i18n.Translator).Gettext.")
+
+	skipArgs = flag.Int("skip-args", 0, "Number of arguments to skip in gettext function call before considering a text message argument. Only applies to keywords without explicit argument positions, use --keyword=NAME:ARGS, --keyword-arity or --keyword-cfg for keywords with other signatures.")
+
+	configFile = flag.String("config", "", "Read the options not given on the command line from FILE, by default from the "+projectConfigName+" file in the current directory or its parents up to the module root.")
+	noConfig   = flag.Bool("no-config", false, "Do not read the "+projectConfigName+" project configuration.")
 
-const (
-	kTypeSingular         = "singular"
-	kTypePlural           = "plural"
-	kTypeContextual       = "contextual"
-	kTypePluralContextual = "pluralContextual"
+	keywordCfgSchema = flag.Bool("keyword-cfg-schema", false, "Print the JSON schema of the --keyword-cfg file and exit.")
+	dumpKeywords     = flag.Bool("dump-keywords", false, "Print the keywords resolved from the defaults, presets, --keyword-cfg files and keyword options as --keyword-cfg JSON and exit. Wrappers found in the source are not included.")
+	validateConfig   = flag.Bool("validate-config", false, "Check the project configuration, the --keyword-cfg files and the other options and exit, with a non-zero status on errors.")
+
+	fromPo             = flag.String("from-po", "", "Read the given PO file instead of extracting strings, used with --verify-completeness.")
+	verifyCompleteness = flag.Bool("verify-completeness", false, "Check that all entries of the --from-po file are translated and exit with 1 if any are missing.")
+	minCompleteness    = flag.Float64("min-completeness", 0, "With --verify-completeness, succeed if at least this percentage of entries are translated.")
+
+	extractCobra      = flag.Bool("extract-cobra", false, "Extract the Use, Short, Long and Example fields of cobra.Command literals.")
+	extractCobraFlags = flag.Bool("extract-cobra-flags", false, "Extract the usage strings of cobra flag definitions like cmd.Flags().StringVarP().")
+	extractGoGenerate = flag.String("extract-go-generate-pattern", "", "Extract the first capture group (or the whole match) of REGEX applied to //go:generate lines.")
+	extractSQLComment = flag.Bool("extract-sql-comment", false, "Extract strings marked with '-- i18n: \"TEXT\"' comments inside raw SQL string literals.")
+	extractEmbed      = flag.Bool("extract-embed", false, "Extract the contents of files embedded with //go:embed into string variables passed to keywords, located in the embedded file.")
 )
 
-type keywordDef struct {
-	Type     string `json:"type"`
-	Name     string `json:"name"`
-	SkipArgs int    `json:"skipArgs"`
+func init() {
+	flag.Var(&outputFormat, "output-format", "Output format, one of: pot, resx, gettext-xml, json (default pot). Use FORMAT:FILE to write the format to FILE instead of --output, can be repeated or comma separated.")
+	flag.Var(&keywordSpecs, "keyword", "Look for the keyword given as NAME[:ARGS] like GNU xgettext does: ARGS are the 1 based positions of the msgid and msgid_plural arguments, a position followed by c is the msgctxt argument and a \"quoted\" string an extracted comment, e.g. pgettext:1c,2. More than two msgid positions each give an entry of their own. Without ARGS the msgid is the first argument after --skip-args. An empty value disables the default keywords like --no-default-keywords (can be repeated).")
+	flag.Var(&keywordCfgs, "keyword-cfg", "Path to keywords configuration file in JSON, YAML (.yaml, .yml) or TOML (.toml, with [[keyword]] tables) format, a directory stands for all such files in it (can be repeated). Keywords defined by several files must be identical. When given --keyword and --keywordPlural are ignored.")
+	flag.Var(&presets, "preset", "Also look for the keywords of a Go i18n library, one of: "+presetNames()+" (can be repeated).")
+	flag.Var(&keywordArities, "keyword-arity", "Look for the keyword given as NAME:TYPE:SKIPARGS[:MSGIDARG[:MSGIDPLURALARG]] with zero based argument positions (can be repeated).")
+	flag.StringVar(&filesFrom, "files-from", "", "Read the input file names from FILE, one per line, - for stdin. Blank lines and lines starting with # are ignored.")
+	flag.StringVar(&filesFrom, "f", "", "Short for --files-from.")
+	flag.BoolVar(&recursive, "recursive", false, "Process all .go files below directory arguments, not only the ones directly in them. DIR/... arguments are always recursive and skip testdata, vendor and directories starting with . or _ like the go tool.")
+	flag.BoolVar(&recursive, "r", false, "Short for --recursive.")
+	flag.Var(&includes, "include", "Only process the files of directory arguments matching the GLOB pattern (can be repeated).")
+	flag.Var(&excludes, "exclude", "Skip files and directories of directory arguments matching the GLOB pattern, e.g. vendor (can be repeated).")
+	flag.Var(&ignoreErrorsIn, "ignore-errors-in", "Suppress WARN: and NOTE: output for files matching the GLOB pattern, strings are still extracted (can be repeated).")
+	flag.Var(&keywordFields, "keyword-field", "Extract the string literals assigned to the struct field TYPE.FIELD in composite literals, e.g. cli.Command.Usage (can be repeated).")
+	flag.Var(&addCommentsTags, "add-comments-tag", "Place the comment blocks preceding keyword lines in output file from the first line starting with TAG on. Tags match in any case and with or without a trailing colon (can be repeated or comma separated).")
+	flag.Var(&referencePrefixStrip, "reference-prefix-strip", "Remove the directory PREFIX from the file names in '#: filename:line' lines, an absolute PREFIX also matches relative file names (can be repeated).")
+	flag.Var(&referencePrefixMap, "reference-prefix-map", "Replace the directory prefix OLD of the file names in '#: filename:line' lines by NEW, given as OLD=NEW, an absolute OLD also matches relative file names (can be repeated).")
+	flag.Var(&headerFields, "header-field", "Set the header field KEY to VALUE in output, given as KEY=VALUE, fields not written by default are added (can be repeated).")
+	flag.Var(&keywordImportAliases, "keyword-import-alias", "Resolve calls through ALIAS as calls into the package PATH, given as PATH:ALIAS (can be repeated).")
 }
 
-type keywords map[string]*keywordDef
+// stringList is a flag.Value collecting repeated string flags
+type stringList []string
 
-type allKeywordsConfig []*keywordDef
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-type msgID struct {
-	msgidPlural string
-	msgctxt     string
-	comment     string
-	fname       string
-	line        int
-	formatHint  string
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-var msgIDs map[string][]msgID
+var keywordTypes = map[string]bool{
+	kTypeSingular:         true,
+	kTypePlural:           true,
+	kTypeContextual:       true,
+	kTypePluralContextual: true,
+	kTypeDomain:           true,
+	kTypePluralDomain:     true,
+}
 
-func formatComment(com string) string {
-	out := ""
-	for _, rawline := range strings.Split(com, "\n") {
-		line := rawline
-		line = strings.TrimPrefix(line, "//")
-		line = strings.TrimPrefix(line, "/*")
-		line = strings.TrimSuffix(line, "*/")
-		line = strings.TrimSpace(line)
-		if line != "" {
-			out += fmt.Sprintf("#. %s\n", line)
+// keywordCfgSchemaJSON describes the --keyword-cfg file, keep it in
+// sync with keywordDef
+const keywordCfgSchemaJSON = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "go-xgettext keyword configuration",
+  "type": "array",
+  "items": {
+    "type": "object",
+    "required": ["name", "type"],
+    "additionalProperties": false,
+    "properties": {
+      "name": {
+        "description": "The keyword as written in the source, e.g. gettext.Gettext or a bare name like _.",
+        "type": "string",
+        "minLength": 1
+      },
+      "importPath": {
+        "description": "Import path of the package of the function name, e.g. github.com/leonelquinteros/gotext with name Get. Only calls of that package match, also when several packages have a function of the same name.",
+        "type": "string"
+      },
+      "namePattern": {
+        "description": "Regular expression matching the whole names of a family of functions, e.g. msg[A-Z]\\w*, name is only a label then.",
+        "type": "string"
+      },
+      "type": {
+        "description": "The kind of strings the keyword takes.",
+        "enum": ["singular", "plural", "contextual", "pluralContextual", "domain", "pluralDomain"]
+      },
+      "skipArgs": {
+        "description": "Number of arguments before the domain (domain types), msgctxt (contextual types) or msgid argument, domainArg, msgctxtArg and msgidArg give the positions explicitly.",
+        "type": "integer",
+        "minimum": 0,
+        "default": 0
+      },
+      "domainArg": {
+        "description": "Zero based position of the domain argument of domain types, overrides skipArgs.",
+        "type": "integer",
+        "minimum": 0
+      },
+      "msgctxtArg": {
+        "description": "Zero based position of the msgctxt argument of contextual types, overrides skipArgs.",
+        "type": "integer",
+        "minimum": 0
+      },
+      "msgidArg": {
+        "description": "Zero based position of the msgid argument, overrides skipArgs.",
+        "type": "integer",
+        "minimum": 0
+      },
+      "msgidArgs": {
+        "description": "Zero based positions of several msgid arguments of singular, contextual and domain types, each one gives an entry, overrides msgidArg.",
+        "type": "array",
+        "items": {
+          "type": "integer",
+          "minimum": 0
+        },
+        "minItems": 1
+      },
+      "msgidRest": {
+        "description": "Also extract all arguments after the last of msgidArgs, for variadic functions.",
+        "type": "boolean",
+        "default": false
+      },
+      "msgidPluralArg": {
+        "description": "Zero based position of the msgid_plural argument, defaults to the one after msgidArg.",
+        "type": "integer",
+        "minimum": 0
+      },
+      "autoComment": {
+        "description": "Extracted comment added to every string of this keyword, e.g. a fixed hint like This is a button label.",
+        "type": "string"
+      },
+      "format": {
+        "description": "Format flag always written for the strings of this keyword, e.g. go-format. no-format writes no-c-format for strings whose % is literal, auto detects the flag from the format verbs like for other keywords.",
+        "type": "string"
+      },
+      "domain": {
+        "description": "Domain of the strings of this keyword, overrides --domain, the domain argument of domain types overrides it.",
+        "type": "string"
+      }
+    }
+  }
+}
+`
+
+// parseKeywordArity parses NAME:TYPE:SKIPARGS[:MSGIDARG[:MSGIDPLURALARG]]
+func parseKeywordArity(spec string) (*keywordDef, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 3 || len(parts) > 5 {
+		return nil, fmt.Errorf("invalid keyword arity %q, expected NAME:TYPE:SKIPARGS[:MSGIDARG[:MSGIDPLURALARG]]", spec)
+	}
+	if !keywordTypes[parts[1]] {
+		return nil, fmt.Errorf("invalid keyword arity %q, unknown type %q", spec, parts[1])
+	}
+
+	var idx []int
+	for _, part := range parts[2:] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid keyword arity %q, invalid argument position %q", spec, part)
 		}
+		idx = append(idx, n)
+	}
+	def := &keywordDef{
+		Name:     parts[0],
+		Type:     parts[1],
+		SkipArgs: idx[0],
+	}
+	if len(idx) > 1 {
+		def.MsgidArg = &idx[1]
+	}
+	if len(idx) > 2 {
+		def.MsgidPluralArg = &idx[2]
 	}
 
-	return out
+	return def, nil
 }
 
-func findCommentsForTranslation(fset *token.FileSet, f *ast.File, posCall token.Position) string {
-	com := ""
-	for _, cg := range f.Comments {
-		// search for all comments in the previous line
-		for i := len(cg.List) - 1; i >= 0; i-- {
-			c := cg.List[i]
+// defaultKeywordSpecs are used in addition to the --keyword values
+// unless --no-default-keywords is given or one of these is empty
+var defaultKeywordSpecs = []string{"gettext.Gettext", "gettext.NGettext:1,2", "gettext.CGettext:1c,2"}
+
+// parseKeywordSpec parses the GNU xgettext keyword syntax NAME[:ARGS],
+// ARGS without a position default to the msgid at skip
+func parseKeywordSpec(spec string, skip int) (*keywordDef, error) {
+	name, args := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		name, args = spec[:idx], spec[idx+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid keyword %q, missing name", spec)
+	}
+	def := &keywordDef{Type: kTypeSingular, Name: name}
+	if args == "" {
+		def.SkipArgs = skip
+		return def, nil
+	}
 
-			posComment := fset.Position(c.End())
-			//println(posCall.Line, posComment.Line, c.Text)
-			if posCall.Line == posComment.Line+1 {
-				posCall = posComment
-				com = fmt.Sprintf("%s\n%s", c.Text, com)
+	var msgidArgs []int
+	for _, part := range splitKeywordArgs(args) {
+		if strings.HasPrefix(part, `"`) {
+			comment, err := strconv.Unquote(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keyword %q, invalid comment %s", spec, part)
 			}
+			def.AutoComment = comment
+			continue
+		}
+		suffix := strings.TrimLeft(part, "0123456789")
+		n, err := strconv.Atoi(strings.TrimSuffix(part, suffix))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid keyword %q, invalid argument position %q", spec, part)
+		}
+		n--
+		switch suffix {
+		case "":
+			msgidArgs = append(msgidArgs, n)
+		case "c":
+			def.MsgctxtArg = &n
+		case "t":
+			return nil, fmt.Errorf("invalid keyword %q, argument counts like %q are not supported", spec, part)
+		default:
+			return nil, fmt.Errorf("invalid keyword %q, invalid argument position %q", spec, part)
 		}
 	}
 
-	// only return if we have a matching prefix
-	formatedComment := formatComment(com)
-	needle := fmt.Sprintf("#. %s", *addCommentsTag)
-	if !strings.HasPrefix(formatedComment, needle) {
-		formatedComment = ""
+	contextual := def.MsgctxtArg != nil
+	switch {
+	case len(msgidArgs) == 0:
+		return nil, fmt.Errorf("invalid keyword %q, missing msgid position", spec)
+	case len(msgidArgs) == 1 && contextual:
+		def.Type = kTypeContextual
+		def.MsgidArg = &msgidArgs[0]
+	case len(msgidArgs) == 1:
+		def.MsgidArg = &msgidArgs[0]
+	case len(msgidArgs) == 2 && contextual:
+		def.Type = kTypePluralContextual
+		def.MsgidArg, def.MsgidPluralArg = &msgidArgs[0], &msgidArgs[1]
+	case len(msgidArgs) == 2:
+		def.Type = kTypePlural
+		def.MsgidArg, def.MsgidPluralArg = &msgidArgs[0], &msgidArgs[1]
+	case contextual:
+		def.Type = kTypeContextual
+		def.MsgidArgs = msgidArgs
+	default:
+		def.MsgidArgs = msgidArgs
 	}
 
-	return formatedComment
+	return def, nil
 }
 
-func constructValue(val interface{}) (string, error) {
-	switch val.(type) {
-	case *ast.BasicLit:
-		return val.(*ast.BasicLit).Value, nil
-	// this happens for constructs like:
-	//  gettext.Gettext("foo" + "bar")
-	case *ast.BinaryExpr:
-		// we only support string concat
-		if val.(*ast.BinaryExpr).Op != token.ADD {
-			return "", nil
+// splitKeywordArgs splits the ARGS of a keyword spec at the commas
+// outside of "quoted" comments
+func splitKeywordArgs(args string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, args[start:i])
+				start = i + 1
+			}
 		}
-		left, err := constructValue(val.(*ast.BinaryExpr).X)
+	}
+	return append(parts, args[start:])
+}
+
+// parseImportAliases maps import aliases to the package name they
+// stand for, e.g. "github.com/leonelquinteros/gotext:gt" maps gt to gotext
+// and "example.com/lib/v2:l" maps l to lib
+func parseImportAliases(specs []string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, ":")
+		if idx <= 0 || idx == len(spec)-1 {
+			return nil, fmt.Errorf("invalid import alias %q, expected PATH:ALIAS", spec)
+		}
+		aliases[spec[idx+1:]] = defaultPackageName(spec[:idx])
+	}
+	return aliases, nil
+}
+
+// decodeKeywordCfg decodes the --keyword-cfg file, YAML (.yaml, .yml)
+// and TOML (.toml) files are converted to JSON first so that all three
+// share the JSON field names and the schema. TOML files list the
+// keywords as [[keyword]] tables.
+func decodeKeywordCfg(fname string, data []byte) ([]*keywordDef, error) {
+	var doc interface{}
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %v", fname, err)
+		}
+	case ".toml":
+		var tables struct {
+			Keyword []map[string]interface{} `toml:"keyword"`
+		}
+		if _, err := toml.Decode(string(data), &tables); err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %v", fname, err)
+		}
+		doc = tables.Keyword
+	}
+	if doc != nil {
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("cannot convert %s: %v", fname, err)
+		}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", fname, err)
+	}
+	var keywordList []*keywordDef
+	names := make(map[string]bool)
+	for i, item := range items {
+		// typos in field names must not go unnoticed
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.DisallowUnknownFields()
+		keyword := &keywordDef{}
+		if err := dec.Decode(keyword); err != nil {
+			return nil, fmt.Errorf("%s: keyword #%d: %s", fname, i+1, strings.TrimPrefix(err.Error(), "json: "))
+		}
+		if err := validateKeywordDef(keyword); err != nil {
+			return nil, fmt.Errorf("%s: keyword #%d: %v", fname, i+1, err)
+		}
+		if names[keyword.key()] {
+			return nil, fmt.Errorf("%s: keyword #%d: duplicate keyword %q", fname, i+1, keyword.key())
+		}
+		names[keyword.key()] = true
+		keywordList = append(keywordList, keyword)
+	}
+	return keywordList, nil
+}
+
+// validateKeywordDef checks a keyword read from a --keyword-cfg file
+func validateKeywordDef(keyword *keywordDef) error {
+	if keyword.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if keyword.Type == "" {
+		return fmt.Errorf("missing type")
+	}
+	if !keywordTypes[keyword.Type] {
+		var types []string
+		for t := range keywordTypes {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("unknown type %q, expected one of: %s", keyword.Type, strings.Join(types, ", "))
+	}
+	if keyword.SkipArgs < 0 {
+		return fmt.Errorf("negative skipArgs %d", keyword.SkipArgs)
+	}
+	for _, arg := range []struct {
+		name string
+		idx  *int
+	}{
+		{"domainArg", keyword.DomainArg},
+		{"msgctxtArg", keyword.MsgctxtArg},
+		{"msgidArg", keyword.MsgidArg},
+		{"msgidPluralArg", keyword.MsgidPluralArg},
+	} {
+		if arg.idx != nil && *arg.idx < 0 {
+			return fmt.Errorf("negative %s %d", arg.name, *arg.idx)
+		}
+	}
+	for _, idx := range keyword.MsgidArgs {
+		if idx < 0 {
+			return fmt.Errorf("negative position %d in msgidArgs", idx)
+		}
+	}
+	if (len(keyword.MsgidArgs) > 0 || keyword.MsgidRest) && keyword.Type != kTypeSingular && keyword.Type != kTypeContextual && keyword.Type != kTypeDomain {
+		return fmt.Errorf("type %q cannot have msgidArgs or msgidRest", keyword.Type)
+	}
+	if keyword.MsgidRest && len(keyword.MsgidArgs) == 0 {
+		return fmt.Errorf("msgidRest without msgidArgs")
+	}
+	if keyword.NamePattern != "" {
+		if _, err := regexp.Compile(keyword.NamePattern); err != nil {
+			return fmt.Errorf("invalid namePattern: %v", err)
+		}
+	}
+	return nil
+}
+
+// keywordCfgExts are the file types read from --keyword-cfg directories
+var keywordCfgExts = map[string]bool{
+	".json": true,
+	".yaml": true,
+	".yml":  true,
+	".toml": true,
+}
+
+// keywordCfgFiles returns the --keyword-cfg files, directories are
+// replaced by the configuration files in them
+func keywordCfgFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		// strip right " (or `)
-		left = left[0 : len(left)-1]
-		right, err := constructValue(val.(*ast.BinaryExpr).Y)
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := ioutil.ReadDir(p)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && keywordCfgExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+				files = append(files, filepath.Join(p, entry.Name()))
+			}
 		}
-		// strip left " (or `)
-		right = right[1:len(right)]
-		return left + right, nil
-	default:
-		return "", fmt.Errorf("unknown type: %v", val)
 	}
+	return files, nil
 }
 
-func parseFunExpr(path string, expr ast.Expr) string {
-	switch sel := expr.(type) {
-	case *ast.Ident:
-		if path != "" {
-			path = "." + path
+// readKeywordCfgs merges the keywords of the --keyword-cfg files, a
+// keyword defined differently by two files is an error
+func readKeywordCfgs(paths []string) (keywords, error) {
+	files, err := keywordCfgFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	k := make(keywords)
+	origin := make(map[string]string)
+	for _, fname := range files {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
 		}
-		return sel.Name + path
-	case *ast.SelectorExpr:
-		if path != "" {
-			path = "." + path
+		keywordList, err := decodeKeywordCfg(fname, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, keyword := range keywordList {
+			key := keyword.key()
+			if prev, ok := k[key]; ok && !reflect.DeepEqual(prev, keyword) {
+				return nil, fmt.Errorf("keyword %q is defined differently in %s and %s", key, origin[key], fname)
+			}
+			k[key] = keyword
+			origin[key] = fname
+		}
+	}
+	return k, nil
+}
+
+// writeKeywords writes k sorted by name in the --keyword-cfg format,
+// keywords reachable through import aliases are listed by alias
+func writeKeywords(w io.Writer, k keywords) error {
+	var names []string
+	for name := range k {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keywordList := []*keywordDef{}
+	for _, name := range names {
+		keyword := *k[name]
+		if name != keyword.key() {
+			keyword.Name, keyword.ImportPath = name, ""
 		}
-		return parseFunExpr(sel.Sel.Name+path, sel.X)
+		keywordList = append(keywordList, &keyword)
+	}
+	data, err := json.MarshalIndent(keywordList, "", "  ")
+	if err != nil {
+		return err
 	}
-	return ""
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
 }
 
-func inspectNodeForTranslations(k keywords, fset *token.FileSet, f *ast.File, n ast.Node) bool {
-	switch x := n.(type) {
-	case *ast.CallExpr:
-		var i18nStr, i18nStrPlural, i18nCtxt string
+func parseKeywords() (keywords, error) {
+	k := make(keywords)
+	if len(keywordCfgs) > 0 {
 		var err error
-		name := parseFunExpr("", x.Fun)
-		if name == "" {
-			break
-		}
-		if keyword, ok := k[name]; ok {
-			idx := keyword.SkipArgs
-			switch keyword.Type {
-			case kTypeSingular:
-				i18nStr, err = constructValue(x.Args[idx])
-			case kTypePlural:
-				i18nStr, err = constructValue(x.Args[idx])
-				if err != nil {
-					break
-				}
-				i18nStrPlural, err = constructValue(x.Args[idx+1])
-			case kTypeContextual:
-				i18nCtxt, err = constructValue(x.Args[idx])
-				if err != nil {
-					break
-				}
-				i18nStr, err = constructValue(x.Args[idx+1])
-			case kTypePluralContextual:
-				i18nCtxt, err = constructValue(x.Args[idx])
-				if err != nil {
-					break
-				}
-				i18nStr, err = constructValue(x.Args[idx+1])
-				if err != nil {
-					break
+		if k, err = readKeywordCfgs(keywordCfgs); err != nil {
+			return nil, err
+		}
+	} else {
+		specs := defaultKeywordSpecs
+		if *noDefaultKeywords {
+			specs = nil
+		}
+		for _, spec := range keywordSpecs {
+			if spec == "" {
+				specs = nil
+			}
+		}
+		for _, spec := range append(specs, keywordSpecs...) {
+			if spec == "" {
+				continue
+			}
+			def, err := parseKeywordSpec(spec, *skipArgs)
+			if err != nil {
+				return nil, err
+			}
+			k[def.Name] = def
+		}
+		// the deprecated aliases of --keyword
+		for _, alias := range []struct{ typ, name string }{
+			{kTypePlural, *keywordPlural},
+			{kTypeContextual, *keywordContextual},
+			{kTypePluralContextual, *keywordPluralContextual},
+		} {
+			if alias.name != "" {
+				k[alias.name] = &keywordDef{
+					Type:     alias.typ,
+					Name:     alias.name,
+					SkipArgs: *skipArgs,
 				}
-				i18nStrPlural, err = constructValue(x.Args[idx+2])
 			}
 		}
+		if *keywordFormat != "" {
+			k[*keywordFormat] = &keywordDef{
+				Type:     kTypeSingular,
+				Name:     *keywordFormat,
+				SkipArgs: *skipArgs,
+				Format:   "go-format",
+			}
+		}
+	}
+
+	if *keywordBare != "" {
+		if strings.Contains(*keywordBare, ".") {
+			return nil, fmt.Errorf("invalid bare keyword %q, must not be qualified", *keywordBare)
+		}
+		k[*keywordBare] = &keywordDef{
+			Type: kTypeSingular,
+			Name: *keywordBare,
+		}
+	}
+
+	for _, spec := range keywordArities {
+		def, err := parseKeywordArity(spec)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "WARN: Unable to obtain value at %s: %v\n", fset.Position(n.Pos()), err)
-			break
+			return nil, err
 		}
+		k[def.Name] = def
+	}
 
-		if i18nStr == "" {
-			break
+	selected, err := selectedPresets(presets)
+	if err != nil {
+		return nil, err
+	}
+	for _, preset := range selected {
+		for _, def := range preset.keywords {
+			k[def.Name] = def
 		}
+	}
 
-		// FIXME: too simplistic(?), no %% is considered
-		formatHint := ""
-		if strings.Contains(i18nStr, "%") || strings.Contains(i18nStrPlural, "%") {
-			// well, not quite correct but close enough
-			formatHint = "c-format"
+	// make "alias.Func" match the keyword "pkg.Func"
+	aliases, err := parseImportAliases(keywordImportAliases)
+	if err != nil {
+		return nil, err
+	}
+	aliased := make(keywords)
+	for alias, pkg := range aliases {
+		for name, def := range k {
+			if strings.HasPrefix(name, pkg+".") {
+				aliased[alias+strings.TrimPrefix(name, pkg)] = def
+			}
 		}
+	}
+	for name, def := range aliased {
+		k[name] = def
+	}
+
+	return k, nil
+}
+
+var npluralsRe = regexp.MustCompile(`nplurals\s*=\s*(\d+)`)
 
-		msgidStr := formatI18nStr(i18nStr)
-		posCall := fset.Position(n.Pos())
-		msgIDs[msgidStr] = append(msgIDs[msgidStr], msgID{
-			formatHint:  formatHint,
-			msgidPlural: formatI18nStr(i18nStrPlural),
-			msgctxt:     formatI18nStr(i18nCtxt),
-			fname:       posCall.Filename,
-			line:        posCall.Line,
-			comment:     findCommentsForTranslation(fset, f, posCall),
-		})
+// parseNPlurals returns the nplurals value of a Plural-Forms formula
+func parseNPlurals(formula string) (int, error) {
+	m := npluralsRe.FindStringSubmatch(formula)
+	if m == nil {
+		return 0, fmt.Errorf("no nplurals in plural formula %q", formula)
 	}
+	return strconv.Atoi(m[1])
+}
 
-	return true
+// isFlagSet returns true if the flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func formatI18nStr(s string) string {
-	if s == "" {
-		return ""
+// newExtractorFromFlags creates an Extractor configured by the
+// command line flags
+func newExtractorFromFlags() (*Extractor, error) {
+	k, err := parseKeywords()
+	if err != nil {
+		return nil, err
 	}
-	// the "`" is special
-	if s[0] == '`' {
-		// replace inner " with \"
-		s = strings.Replace(s, "\"", "\\\"", -1)
-		// replace \n with \\n
-		s = strings.Replace(s, "\n", "\\n", -1)
+
+	if *sortOutput && *sortByFile {
+		return nil, fmt.Errorf("--sort-output and --sort-by-file are mutually exclusive")
+	}
+	sortBy := *sortOutputBy
+	switch {
+	case sortBy != "":
+	case *sortOutput:
+		sortBy = "msgid"
+	case *sortByFile:
+		sortBy = "file"
+	}
+	if _, ok := sortOrders[sortBy]; sortBy != "" && !ok {
+		return nil, fmt.Errorf("unknown sort order %q", sortBy)
 	}
-	// strip leading and trailing " (or `)
-	s = s[1 : len(s)-1]
-	return s
-}
 
-func processFiles(args []string) error {
-	// go over the input files
-	msgIDs = make(map[string][]msgID)
+	sep, err := strconv.Unquote(`"` + *contextualKeySeparator + `"`)
+	if err != nil {
+		sep = *contextualKeySeparator
+	}
 
-	fset := token.NewFileSet()
-	for _, fname := range args {
-		if err := processSingleGoSource(fset, fname); err != nil {
-			return err
+	e := &Extractor{
+		Keywords:               k,
+		Verbose:                *verbose,
+		AddComments:            *addComments,
+		AddCommentsTags:        splitCommentTags(addCommentsTags),
+		MaxCommentLines:        *maxCommentLines,
+		SortBy:                 sortBy,
+		AddLocation:            *addLocation,
+		Width:                  *width,
+		NoWrap:                 *noWrap,
+		LiteralLocation:        *literalLocation,
+		LocationEndLine:        *locationEndLine,
+		LocationColumns:        *locationColumns,
+		StripFilePrefix:        *stripFilePrefix,
+		RelativeTo:             *relativeTo,
+		OmitHeader:             *omitHeader,
+		CopyrightHolder:        *copyrightHolder,
+		CopyrightYear:          *copyrightYear,
+		Charset:                *charset,
+		PackageName:            *packageName,
+		PackageVersion:         *packageVersion,
+		ForeignUser:            *foreignUser,
+		MsgIDBugsAddress:       *msgIDBugsAddress,
+		NoFuzzy:                *noFuzzy,
+		Language:               *language,
+		LanguageTeam:           *languageTeam,
+		TranslationURL:         *translationURL,
+		RevisionDate:           *potRevisionDate,
+		RevisionDateFromGit:    *potRevisionDateFromGit,
+		NoDate:                 *noDate,
+		AddPluralFormsComment:  *addPluralFormsComment,
+		PluralForms:            *pluralFormsSlots,
+		PluralFormula:          *pluralFormula,
+		AddMetadata:            *addMetadata,
+		ContextualKeySeparator: sep,
+		FormatHint:             *formatHint,
+		Domain:                 *domain,
+		MsgidDomainPrefix:      *msgidDomainPrefix,
+		WarnPluralWithoutN:     *warnPluralWithoutN,
+		WarnPluralFormat:       *warnPluralFormat,
+		WarnDynamic:            *warnDynamic,
+		ValidateCalls:          *validateCalls,
+		IgnoreErrorsIn:         ignoreErrorsIn,
+		DiagnosticsFormat:      *diagnosticsFormat,
+		KeepObsolete:           *keepObsolete,
+		SkipTests:              *skipTests,
+		ContinueOnError:        *continueOnError || *keepGoing,
+		TypeCheck:              *typeCheck,
+		AllPlatforms:           *allPlatforms,
+		AutoKeywords:           !*noAutoKeywords,
+		TrackFuncValues:        *trackFuncValues,
+		ExtractCobra:           *extractCobra,
+		ExtractCobraFlags:      *extractCobraFlags,
+		ExtractSQLComment:      *extractSQLComment,
+		ExtractEmbed:           *extractEmbed,
+	}
+	if e.CreationTime, err = parseCreationDate(*creationDate, os.Getenv("SOURCE_DATE_EPOCH")); err != nil {
+		return nil, err
+	}
+	if e.PrefixMap, err = parsePrefixMap(referencePrefixStrip, referencePrefixMap); err != nil {
+		return nil, err
+	}
+	if e.HeaderFields, err = parseHeaderFields(headerFields); err != nil {
+		return nil, err
+	}
+	if *noLocation {
+		e.AddLocation = locationNever
+	}
+	switch e.AddLocation {
+	case locationFull, locationFile, locationNever:
+	default:
+		return nil, fmt.Errorf("invalid --add-location %q, must be one of: full, file, never", e.AddLocation)
+	}
+	if e.Width < 0 {
+		return nil, fmt.Errorf("invalid --width %d", e.Width)
+	}
+	if e.PluralForms < 1 {
+		return nil, fmt.Errorf("invalid --plural-forms %d", e.PluralForms)
+	}
+	if e.PluralFormula != "" {
+		n, err := parseNPlurals(e.PluralFormula)
+		if err != nil {
+			return nil, err
+		}
+		if !isFlagSet("plural-forms") {
+			e.PluralForms = n
+		} else if n != e.PluralForms {
+			return nil, fmt.Errorf("--plural-forms %d does not match nplurals=%d of --plural-formula", e.PluralForms, n)
+		}
+	}
+	if !diagnosticsFormats[*diagnosticsFormat] {
+		return nil, fmt.Errorf("unknown diagnostics format %q", *diagnosticsFormat)
+	}
+	if !formatHints[*formatHint] {
+		return nil, fmt.Errorf("unknown format hint %q", *formatHint)
+	}
+	for _, pattern := range ignoreErrorsIn {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --ignore-errors-in pattern %q: %v", pattern, err)
+		}
+	}
+	for _, pattern := range excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --exclude pattern %q: %v", pattern, err)
+		}
+	}
+	for _, pattern := range includes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --include pattern %q: %v", pattern, err)
+		}
+	}
+	if e.AllPlatforms && (*buildTags != "" || *goos != "" || *goarch != "") {
+		return nil, fmt.Errorf("--all-platforms cannot be used with --tags, --goos or --goarch")
+	}
+	for name := range e.Keywords {
+		if strings.HasPrefix(name, "(") && !e.TypeCheck {
+			return nil, fmt.Errorf("method keyword %q requires --type-check", name)
+		}
+	}
+	if e.AllPlatforms && e.TypeCheck {
+		return nil, fmt.Errorf("--all-platforms cannot be used with --type-check")
+	}
+	if *buildTags != "" || *goos != "" || *goarch != "" {
+		ctxt := build.Default
+		if *goos != "" {
+			ctxt.GOOS = *goos
+		}
+		if *goarch != "" {
+			ctxt.GOARCH = *goarch
+		}
+		for _, tag := range strings.Split(*buildTags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				ctxt.BuildTags = append(ctxt.BuildTags, tag)
+			}
+		}
+		e.BuildContext = &ctxt
+	}
+	selected, err := selectedPresets(presets)
+	if err != nil {
+		return nil, err
+	}
+	fields := append([]string(nil), keywordFields...)
+	e.PluralFields = make(map[string]map[string]string)
+	for _, preset := range selected {
+		fields = append(fields, preset.fields...)
+		for typeName, plurals := range preset.pluralFields {
+			if e.PluralFields[typeName] == nil {
+				e.PluralFields[typeName] = make(map[string]string)
+			}
+			for field, pluralField := range plurals {
+				e.PluralFields[typeName][field] = pluralField
+			}
+		}
+	}
+	if e.KeywordFields, err = parseKeywordFields(fields); err != nil {
+		return nil, err
+	}
+	if *extractGoGenerate != "" {
+		e.ExtractGoGenerate, err = regexp.Compile(*extractGoGenerate)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return e, nil
 }
 
-func parseKeywords() (keywords, error) {
-	k := make(keywords)
-	if *keywordCfg != "" {
-		data, err := ioutil.ReadFile(*keywordCfg)
+// parseKeywordFields parses the --keyword-field values of the form
+// TYPE.FIELD, where TYPE may be qualified by its package name
+func parseKeywordFields(values []string) (map[string]map[string]bool, error) {
+	fields := make(map[string]map[string]bool)
+	for _, value := range values {
+		idx := strings.LastIndex(value, ".")
+		if idx <= 0 || idx == len(value)-1 {
+			return nil, fmt.Errorf("invalid keyword field %q, expected TYPE.FIELD", value)
+		}
+		typeName, field := value[:idx], value[idx+1:]
+		if fields[typeName] == nil {
+			fields[typeName] = make(map[string]bool)
+		}
+		fields[typeName][field] = true
+	}
+	return fields, nil
+}
+
+var outputFormats = map[string]func(e *Extractor, w io.Writer) error{
+	"pot":         (*Extractor).Write,
+	"resx":        (*Extractor).WriteResx,
+	"gettext-xml": (*Extractor).WritePox,
+	"json":        (*Extractor).WriteJSON,
+}
+
+// parseCreationDate returns the time of --creation-date, or else of the
+// SOURCE_DATE_EPOCH seconds in UTC, the zero time stands for now
+func parseCreationDate(date, epoch string) (time.Time, error) {
+	if date != "" {
+		for _, layout := range []string{potDateFormat, time.RFC3339} {
+			if t, err := time.Parse(layout, date); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid --creation-date %q", date)
+	}
+	if epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
 		if err != nil {
-			return nil, err
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", epoch)
 		}
-		var keywordList []*keywordDef
-		if err := json.Unmarshal(data, &keywordList); err != nil {
-			return nil, err
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Time{}, nil
+}
+
+// splitCommentTags returns the tags of the --add-comments-tag values
+func splitCommentTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
 		}
-		for _, keyword := range keywordList {
-			k[keyword.Name] = keyword
+	}
+	return tags
+}
+
+// parsePrefixMap returns the mappings of --reference-prefix-strip and
+// the OLD=NEW specs of --reference-prefix-map
+func parsePrefixMap(strips, specs []string) ([]prefixMapping, error) {
+	var mappings []prefixMapping
+	for _, prefix := range strips {
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid empty --reference-prefix-strip")
 		}
-	} else {
-		k[*keyword] = &keywordDef{
-			Type:     kTypeSingular,
-			Name:     *keyword,
-			SkipArgs: *skipArgs,
+		mappings = append(mappings, prefixMapping{old: prefix})
+	}
+	for _, spec := range specs {
+		l := strings.SplitN(spec, "=", 2)
+		if len(l) != 2 || l[0] == "" {
+			return nil, fmt.Errorf("invalid --reference-prefix-map %q, must be OLD=NEW", spec)
 		}
-		k[*keywordPlural] = &keywordDef{
-			Type:     kTypePlural,
-			Name:     *keywordPlural,
-			SkipArgs: *skipArgs,
+		mappings = append(mappings, prefixMapping{old: l[0], new: l[1]})
+	}
+	return mappings, nil
+}
+
+// parseHeaderFields parses the KEY=VALUE specs of --header-field
+func parseHeaderFields(specs []string) ([]headerField, error) {
+	var fields []headerField
+	for _, spec := range specs {
+		l := strings.SplitN(spec, "=", 2)
+		key := strings.TrimSpace(l[0])
+		if len(l) != 2 || key == "" || strings.ContainsAny(key, ": \t\n") || strings.Contains(l[1], "\n") {
+			return nil, fmt.Errorf("invalid header field %q, must be KEY=VALUE", spec)
 		}
-		k[*keywordContextual] = &keywordDef{
-			Type:     kTypeContextual,
-			Name:     *keywordContextual,
-			SkipArgs: *skipArgs,
+		fields = append(fields, headerField{key, strings.TrimSpace(l[1])})
+	}
+	return fields, nil
+}
+
+type outputSpec struct {
+	format string
+	// empty for stdout
+	fname string
+}
+
+// parseOutputSpecs parses the --output-format values of the form
+// FORMAT or FORMAT:FILE, formats without a file go to defaultFile
+func parseOutputSpecs(values []string, defaultFile string) ([]outputSpec, error) {
+	if len(values) == 0 {
+		values = []string{"pot"}
+	}
+
+	var specs []outputSpec
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			spec := outputSpec{format: v, fname: defaultFile}
+			if idx := strings.Index(v, ":"); idx >= 0 {
+				spec = outputSpec{format: v[:idx], fname: v[idx+1:]}
+			}
+			if _, ok := outputFormats[spec.format]; !ok {
+				return nil, fmt.Errorf("unknown output format %q", spec.format)
+			}
+			if seen[spec.fname] {
+				dest := spec.fname
+				if dest == "" {
+					dest = "stdout"
+				}
+				return nil, fmt.Errorf("more than one output format written to %s", dest)
+			}
+			seen[spec.fname] = true
+			specs = append(specs, spec)
 		}
 	}
-	return k, nil
+
+	return specs, nil
+}
+
+func writeOutput(e *Extractor, spec outputSpec) error {
+	if spec.fname == "" {
+		return outputFormats[spec.format](e, os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	if err := outputFormats[spec.format](e, &buf); err != nil {
+		return err
+	}
+	// an empty catalog, e.g. with --omit-header, gives an empty file
+	data := buf.Bytes()
+	if *outputBOM && !*noOutputBOM && len(data) > 0 {
+		data = append([]byte(utf8BOM), data...)
+	}
+
+	if *onlyIfChanged {
+		old, err := ioutil.ReadFile(spec.fname)
+		if err == nil && sameIgnoringCreationDate(old, data) {
+			if e.Verbose {
+				e.notef(token.Position{Filename: spec.fname}, "unchanged-output", "Not writing %s, it is unchanged\n", spec.fname)
+			}
+			return nil
+		}
+	}
+
+	return ioutil.WriteFile(spec.fname, data, 0666)
+}
+
+var creationDateRe = regexp.MustCompile(`(?m)^.*"POT-Creation-Date: [^"]*"$`)
+
+// sameIgnoringCreationDate returns whether the catalogs a and b only
+// differ in their POT-Creation-Date header
+func sameIgnoringCreationDate(a, b []byte) bool {
+	return bytes.Equal(creationDateRe.ReplaceAll(a, nil), creationDateRe.ReplaceAll(b, nil))
 }
 
-func processSingleGoSource(fset *token.FileSet, fname string) error {
-	fnameContent, err := ioutil.ReadFile(fname)
+// joinExistingOutput joins the entries of fname, if it already exists
+func joinExistingOutput(e *Extractor, fname string) error {
+	if fname == "" {
+		return fmt.Errorf("--join-existing requires --output")
+	}
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer f.Close()
 
-	// Create the AST by parsing src.
-	f, err := parser.ParseFile(fset, fname, fnameContent, parser.ParseComments)
+	return e.Join(f)
+}
+
+func runVerifyCompleteness() {
+	if *fromPo == "" {
+		log.Fatalf("--verify-completeness requires --from-po")
+	}
+	f, err := os.Open(*fromPo)
 	if err != nil {
-		panic(err)
+		log.Fatalf("failed to open %s: %s", *fromPo, err)
 	}
+	defer f.Close()
 
-	k, err := parseKeywords()
+	percent, missing, err := checkCompleteness(f, os.Stdout)
 	if err != nil {
-		panic(err)
+		log.Fatalf("failed to parse %s: %s", *fromPo, err)
+	}
+	fmt.Printf("%.1f%% translated, %d missing\n", percent, missing)
+	if *minCompleteness > 0 {
+		if percent < *minCompleteness {
+			os.Exit(1)
+		}
+	} else if missing > 0 {
+		os.Exit(1)
 	}
+}
 
-	ast.Inspect(f, func(n ast.Node) bool {
-		return inspectNodeForTranslations(k, fset, f, n)
-	})
+// walkOptions control which files walkDir returns
+type walkOptions struct {
+	// only the files directly in root unless set
+	recursive    bool
+	includeTests bool
+	// glob patterns matched against the name and the path relative
+	// to root, files need to match one include pattern if any are
+	// given
+	include []string
+	exclude []string
+}
 
-	return nil
+// the directories and files the go tool skips for ./... patterns
+var goPatternExcludes = []string{"testdata", "vendor", ".*", "_*"}
+
+func matchesAny(patterns []string, name, rel string) bool {
+	for _, pattern := range patterns {
+		matchName, _ := filepath.Match(pattern, name)
+		matchRel, _ := filepath.Match(pattern, rel)
+		if matchName || matchRel {
+			return true
+		}
+	}
+	return false
 }
 
-var formatTime = func() string {
-	return time.Now().Format("2006-01-02 15:04-0700")
-}
-
-func writePotFile(out io.Writer) {
-
-	header := fmt.Sprintf(`# SOME DESCRIPTIVE TITLE.
-# Copyright (C) YEAR THE PACKAGE'S COPYRIGHT HOLDER
-# This file is distributed under the same license as the PACKAGE package.
-# FIRST AUTHOR <EMAIL@ADDRESS>, YEAR.
-#
-#, fuzzy
-msgid   ""
-msgstr  "Project-Id-Version: %s\n"
-        "Report-Msgid-Bugs-To: %s\n"
-        "POT-Creation-Date: %s\n"
-        "PO-Revision-Date: YEAR-MO-DA HO:MI+ZONE\n"
-        "Last-Translator: FULL NAME <EMAIL@ADDRESS>\n"
-        "Language-Team: LANGUAGE <LL@li.org>\n"
-        "Language: \n"
-        "MIME-Version: 1.0\n"
-        "Content-Type: text/plain; charset=CHARSET\n"
-        "Content-Transfer-Encoding: 8bit\n"
-
-`, *packageName, *msgIDBugsAddress, formatTime())
-	fmt.Fprintf(out, "%s", header)
-
-	// yes, this is the way to do it in go
-	sortedKeys := []string{}
-	for k := range msgIDs {
-		sortedKeys = append(sortedKeys, k)
-	}
-	if *sortOutput {
-		sort.Strings(sortedKeys)
-	}
-
-	// FIXME: use template here?
-	for _, k := range sortedKeys {
-		msgidList := msgIDs[k]
-		for _, msgid := range msgidList {
-			if *addComments || *addCommentsTag != "" {
-				fmt.Fprintf(out, "%s", msgid.comment)
-			}
+// walkDir returns the .go files of root in lexical order, _test.go
+// files only with includeTests
+func walkDir(root string, opts walkOptions) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
 		}
-		if !*noLocation {
-			fmt.Fprintf(out, "#:")
-			for _, msgid := range msgidList {
-				fmt.Fprintf(out, " %s:%d", msgid.fname, msgid.line)
+		if matchesAny(opts.exclude, d.Name(), rel) || (d.IsDir() && !opts.recursive) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
-			fmt.Fprintf(out, "\n")
+			return nil
 		}
-		msgid := msgidList[0]
-		if msgid.formatHint != "" {
-			fmt.Fprintf(out, "#, %s\n", msgid.formatHint)
+		if d.IsDir() || !strings.HasSuffix(p, ".go") {
+			return nil
 		}
-		var formatOutput = func(in string) string {
-			// split string with \n into multiple lines
-			// to make the output nicer
-			out := strings.Replace(in, "\\n", "\\n\"\n        \"", -1)
-			// cleanup too aggressive splitting (empty "" lines)
-			return strings.TrimSuffix(out, "\"\n        \"")
+		if !opts.includeTests && strings.HasSuffix(p, "_test.go") {
+			return nil
 		}
-		if msgid.msgctxt != "" {
-			fmt.Fprintf(out, "msgctxt \"%v\"\n", formatOutput(msgid.msgctxt))
+		if len(opts.include) > 0 && !matchesAny(opts.include, d.Name(), rel) {
+			return nil
 		}
-		fmt.Fprintf(out, "msgid   \"%v\"\n", formatOutput(k))
-		if msgid.msgidPlural != "" {
-			fmt.Fprintf(out, "msgid_plural   \"%v\"\n", formatOutput(msgid.msgidPlural))
-			fmt.Fprintf(out, "msgstr[0]  \"\"\n")
-			fmt.Fprintf(out, "msgstr[1]  \"\"\n")
-		} else {
-			fmt.Fprintf(out, "msgstr  \"\"\n")
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+// readFileList reads a file list as given to --files-from
+func readFileList(r io.Reader) ([]string, error) {
+	var files []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
-		fmt.Fprintf(out, "\n")
+		files = append(files, line)
 	}
+	return files, scanner.Err()
+}
 
+// filesFromArg returns the file list of the --files-from argument
+func filesFromArg(name string) ([]string, error) {
+	if name == "-" {
+		return readFileList(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readFileList(f)
+}
+
+// expandArgs replaces the directories and DIR/... patterns in args by
+// the files in them
+func expandArgs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		// test files of directories are skipped silently,
+		// Extractor.SkipTests only warns about given ones
+		opts := walkOptions{
+			recursive:    recursive,
+			includeTests: *includeTests && !*skipTests,
+			include:      includes,
+			exclude:      excludes,
+		}
+		root := arg
+		if arg == "..." || strings.HasSuffix(arg, "/...") {
+			root = strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+			if root == "" {
+				root = "."
+			}
+			opts.recursive = true
+			opts.exclude = append(append([]string{}, goPatternExcludes...), excludes...)
+		} else if st, err := os.Stat(arg); err != nil || !st.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := walkDir(root, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
 }
 
 func main() {
 	flag.Parse()
+	if err := loadProjectConfig(); err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *keywordCfgSchema {
+		fmt.Print(keywordCfgSchemaJSON)
+		return
+	}
+	if *validateConfig {
+		if _, err := newExtractorFromFlags(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	if *dumpKeywords {
+		e, err := newExtractorFromFlags()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		if err := writeKeywords(os.Stdout, e.Keywords); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	if *verifyCompleteness {
+		runVerifyCompleteness()
+		return
+	}
+
 	args := flag.Args()
+	if filesFrom != "" {
+		files, err := filesFromArg(filesFrom)
+		if err != nil {
+			log.Fatalf("failed to read file list %s: %s", filesFrom, err)
+		}
+		args = append(args, files...)
+	}
 	if len(args) == 0 {
-		fmt.Println("Usage: go-xgettext [options] file1 ...")
+		fmt.Println("Usage: go-xgettext [options] file1|dir1|dir1/... ...")
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
 
-	if err := processFiles(args); err != nil {
-		log.Fatalf("processFiles failed with: %s", err)
+	e, err := newExtractorFromFlags()
+	if err != nil {
+		log.Fatalf("%s", err)
 	}
 
-	out := os.Stdout
-	if *output != "" {
-		var err error
-		out, err = os.Create(*output)
+	outputSpecs, err := parseOutputSpecs(outputFormat, *output)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	// the structured formats have room for the column and byte offset
+	for _, spec := range outputSpecs {
+		if spec.format == "json" || spec.format == "gettext-xml" {
+			e.Columns = true
+		}
+	}
+	if *splitByDomain && (*joinExisting || len(outputFormat) > 0) {
+		log.Fatalf("--split-by-domain cannot be used with --join-existing or --output-format")
+	}
+
+	args, err = expandArgs(args)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	if *diagnosticsOutput != "" {
+		w, err := os.Create(*diagnosticsOutput)
 		if err != nil {
-			log.Fatalf("failed to create %s: %s", *output, err)
+			log.Fatalf("%s", err)
 		}
+		defer w.Close()
+		e.DiagnosticsOutput = w
+	}
+
+	if err := e.Extract(args); err != nil {
+		log.Fatalf("extracting strings failed with: %s", err)
+	}
+
+	if e.suppressed > 0 {
+		e.notef(token.Position{}, "suppressed", "%d keyword calls suppressed by xgettext:ignore\n", e.suppressed)
+	}
+
+	for _, diag := range validateMsgIDs(e.msgIDs) {
+		if *strict {
+			log.Fatalf("%s", diag)
+		}
+		e.warnf(token.Position{}, "conflict", "%s\n", diag)
+	}
+
+	if *joinExisting {
+		if err := joinExistingOutput(e, *output); err != nil {
+			log.Fatalf("failed to join %s: %s", *output, err)
+		}
+	}
+
+	if *splitByDomain {
+		dir := "."
+		if *output != "" {
+			dir = filepath.Dir(*output)
+		}
+		outputSpecs = nil
+		for domain, de := range e.splitByDomain() {
+			spec := outputSpec{format: "pot", fname: filepath.Join(dir, domain+".pot")}
+			if err := writeOutput(de, spec); err != nil {
+				log.Fatalf("failed to write %s: %s", spec.fname, err)
+			}
+		}
+	}
+
+	for _, spec := range outputSpecs {
+		if err := writeOutput(e, spec); err != nil {
+			log.Fatalf("failed to write %s: %s", spec.fname, err)
+		}
+	}
+
+	if *keepGoing && len(e.failedFiles) > 0 {
+		log.Fatalf("%d of %d files could not be processed", len(e.failedFiles), len(e.failedFiles)+len(e.processedFiles))
 	}
-	writePotFile(out)
 }
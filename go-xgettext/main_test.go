@@ -28,11 +28,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -41,6 +52,7 @@ import (
 func Test(t *testing.T) { TestingT(t) }
 
 type xgettextTestSuite struct {
+	e *Extractor
 }
 
 var _ = Suite(&xgettextTestSuite{})
@@ -54,21 +66,139 @@ func makeGoSourceFile(c *C, content []byte) string {
 	return fname
 }
 
+// test helper
+func captureStderr(c *C, f func()) string {
+	tmp, err := ioutil.TempFile(c.MkDir(), "stderr")
+	c.Assert(err, IsNil)
+	defer tmp.Close()
+
+	oldStderr := os.Stderr
+	os.Stderr = tmp
+	defer func() { os.Stderr = oldStderr }()
+	f()
+
+	data, err := ioutil.ReadFile(tmp.Name())
+	c.Assert(err, IsNil)
+	return string(data)
+}
+
 func (s *xgettextTestSuite) SetUpTest(c *C) {
-	// our test defaults
+	// our test defaults, the flags are still used by main() and
+	// parseKeywords()
 	*noLocation = false
-	*addCommentsTag = "TRANSLATORS:"
-	*keyword = "i18n.G"
-	*keywordPlural = "i18n.NG"
-	*keywordContextual = "i18n.CG"
+	*addLocation = locationFull
+	addCommentsTags = stringList{"TRANSLATORS:"}
+	keywordSpecs = stringList{"", "i18n.G", "i18n.NG:1,2", "i18n.CG:1c,2"}
+	*noDefaultKeywords = false
+	*keywordPlural = ""
+	*keywordContextual = ""
+	*keywordPluralContextual = ""
 	*sortOutput = true
 	*packageName = "snappy"
 	*msgIDBugsAddress = "snappy-devel@lists.ubuntu.com"
+	*potRevisionDate = false
+	*creationDate = ""
+	*noDate = false
+	// e.g. set by distribution package builds
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	*potRevisionDateFromGit = false
+	*extractSQLComment = false
+	*extractEmbed = false
+	*extractCobra = false
+	*outputBOM = false
+	*onlyIfChanged = false
+	*keywordFormat = ""
+	keywordImportAliases = nil
+	*language = ""
+	*languageTeam = ""
+	*translationURL = ""
+	*noFuzzy = false
+	*contextualKeySeparator = `\u0004`
+	*warnPluralWithoutN = false
+	*warnPluralFormat = false
+	*skipArgs = 0
+	*addMetadata = false
+	outputFormat = nil
+	*output = ""
+	*extractCobraFlags = false
+	*addPluralFormsComment = false
+	*verbose = false
+	*sortOutputBy = ""
+	*sortByFile = false
+	*maxCommentLines = 20
+	*extractGoGenerate = ""
+	*skipTests = false
+	keywordArities = nil
+	keywordFields = nil
+	presets = nil
+	ignoreErrorsIn = nil
+	*formatHint = "auto"
+	recursive = false
+	*includeTests = false
+	excludes = nil
+	includes = nil
+	*joinExisting = false
+	*keepObsolete = false
+	*continueOnError = false
+	*keepGoing = false
+	*warnDynamic = false
+	*validateCalls = false
+	*noAutoKeywords = false
+	*trackFuncValues = false
+	*splitByDomain = false
+	*literalLocation = false
+	*locationEndLine = false
+	*locationColumns = false
+	*diagnosticsFormat = "text"
+	*diagnosticsOutput = ""
+	*typeCheck = false
+	*allPlatforms = false
+	*stripFilePrefix = ""
+	*relativeTo = ""
+	*pluralFormsSlots = 2
+	*pluralFormula = ""
+	*copyrightHolder = ""
+	*foreignUser = false
+	*packageVersion = ""
+	headerFields = nil
+	referencePrefixStrip = nil
+	referencePrefixMap = nil
+	*copyrightYear = 0
+	*charset = "UTF-8"
+	*omitHeader = false
+	*buildTags = ""
+	*goos = ""
+	*goarch = ""
+	keywordCfgs = nil
+	*strict = false
+	filesFrom = ""
+	*keywordBare = ""
+	*noOutputBOM = false
+	*domain = ""
+	*msgidDomainPrefix = false
+
+	s.e = &Extractor{
+		Keywords: keywords{
+			"i18n.G":  {Type: kTypeSingular, Name: "i18n.G"},
+			"i18n.NG": {Type: kTypePlural, Name: "i18n.NG"},
+			"i18n.CG": {Type: kTypeContextual, Name: "i18n.CG"},
+		},
+		AddCommentsTags:        []string{"TRANSLATORS:"},
+		MaxCommentLines:        20,
+		SortBy:                 "msgid",
+		Charset:                "UTF-8",
+		PackageName:            "snappy",
+		MsgIDBugsAddress:       "snappy-devel@lists.ubuntu.com",
+		ContextualKeySeparator: "\x04",
+	}
 
 	// mock time
 	formatTime = func() string {
 		return "2015-06-30 14:48+0200"
 	}
+	currentYear = func() int {
+		return 2015
+	}
 }
 
 func (s *xgettextTestSuite) TestFormatComment(c *C) {
@@ -95,10 +225,10 @@ func main() {
     i18n.G("foo")
 }
 `))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
-	c.Assert(msgIDs, DeepEquals, map[string][]msgID{
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
 		"foo": []msgID{
 			{
 				comment: "#. TRANSLATORS: foo comment\n",
@@ -120,10 +250,10 @@ func main() {
     i18n.G("foo")
 }
 `))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
-	c.Assert(msgIDs, DeepEquals, map[string][]msgID{
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
 		"foo": []msgID{
 			{
 				comment: "#. TRANSLATORS: foo comment\n",
@@ -141,7 +271,7 @@ func main() {
 
 const header = `# SOME DESCRIPTIVE TITLE.
 # Copyright (C) YEAR THE PACKAGE'S COPYRIGHT HOLDER
-# This file is distributed under the same license as the PACKAGE package.
+# This file is distributed under the same license as the snappy package.
 # FIRST AUTHOR <EMAIL@ADDRESS>, YEAR.
 #
 #, fuzzy
@@ -154,12 +284,47 @@ msgstr  "Project-Id-Version: snappy\n"
         "Language-Team: LANGUAGE <LL@li.org>\n"
         "Language: \n"
         "MIME-Version: 1.0\n"
-        "Content-Type: text/plain; charset=CHARSET\n"
+        "Content-Type: text/plain; charset=UTF-8\n"
         "Content-Transfer-Encoding: 8bit\n"
 `
 
+func (s *xgettextTestSuite) TestExtractorsAreIndependent(c *C) {
+	fname1 := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	fname2 := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    gettext.Gettext("bar")
+}
+`))
+	other := &Extractor{
+		Keywords: keywords{
+			"gettext.Gettext": {Type: kTypeSingular, Name: "gettext.Gettext"},
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- other.Extract([]string{fname1, fname2})
+	}()
+	err := s.e.Extract([]string{fname1, fname2})
+	c.Assert(err, IsNil)
+	c.Assert(<-done, IsNil)
+
+	c.Check(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{{fname: fname1, line: 4}},
+	})
+	c.Check(other.msgIDs, DeepEquals, map[string][]msgID{
+		"bar": []msgID{{fname: fname2, line: 4}},
+	})
+}
+
 func (s *xgettextTestSuite) TestWriteOutputSimple(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				fname:   "fname",
@@ -169,7 +334,7 @@ func (s *xgettextTestSuite) TestWriteOutputSimple(c *C) {
 		},
 	}
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #. foo
@@ -182,7 +347,7 @@ msgstr  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputMultiple(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				fname:   "fname",
@@ -197,7 +362,7 @@ func (s *xgettextTestSuite) TestWriteOutputMultiple(c *C) {
 		},
 	}
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #. comment1
@@ -210,8 +375,94 @@ msgstr  ""
 	c.Assert(out.String(), Equals, expected)
 }
 
+func (s *xgettextTestSuite) TestWriteOutputMultipleDeduplicated(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname:   "fname",
+				line:    2,
+				comment: "#. comment1\n",
+			},
+			{
+				fname:      "fname",
+				line:       4,
+				comment:    "#. comment2\n",
+				formatHint: "go-format",
+			},
+			{
+				fname:   "fname",
+				line:    6,
+				comment: "#. comment1\n",
+			},
+		},
+	}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+#. comment1
+#. comment2
+#: fname:2 fname:4 fname:6
+#, go-format
+msgid   "foo"
+msgstr  ""
+
+`, header)
+	c.Assert(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputFormatHintOfFormatUse(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"100%": []msgID{
+			{
+				fname:      "fname",
+				line:       2,
+				formatHint: "no-c-format",
+			},
+			{
+				fname:      "fname",
+				line:       4,
+				formatHint: "c-format",
+			},
+			{
+				fname:      "fname",
+				line:       6,
+				formatHint: "go-format",
+			},
+		},
+		"50%": []msgID{
+			{
+				fname:      "fname",
+				line:       8,
+				formatHint: "no-c-format",
+			},
+			{
+				fname: "fname",
+				line:  10,
+			},
+		},
+	}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	// never both c-format and no-c-format
+	expected := fmt.Sprintf(`%s
+#: fname:2 fname:4 fname:6
+#, c-format
+msgid   "100%%"
+msgstr  ""
+
+#: fname:8 fname:10
+#, no-c-format
+msgid   "50%%"
+msgstr  ""
+
+`, header)
+	c.Assert(out.String(), Equals, expected)
+}
+
 func (s *xgettextTestSuite) TestWriteOutputNoComment(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				fname: "fname",
@@ -220,7 +471,7 @@ func (s *xgettextTestSuite) TestWriteOutputNoComment(c *C) {
 		},
 	}
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: fname:2
@@ -231,8 +482,41 @@ msgstr  ""
 	c.Assert(out.String(), Equals, expected)
 }
 
+func (s *xgettextTestSuite) TestWriteOutputAddLocationFile(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{
+			{fname: "b.go", line: 2},
+			{fname: "a.go", line: 7, literalLine: 8},
+			{fname: "b.go", line: 9},
+		},
+	}
+	s.e.OmitHeader = true
+	s.e.AddLocation = locationFile
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, `#: a.go b.go
+msgid   "foo"
+msgstr  ""
+
+`)
+
+	out.Reset()
+	c.Assert(s.e.WriteJSON(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*"locations": \[\s+\{\s+"file": "b.go"\s+\},\s+\{\s+"file": "a.go"\s+\}\s+\].*`)
+
+	*noLocation = true
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.AddLocation, Equals, locationNever)
+
+	*noLocation = false
+	*addLocation = "lines"
+	_, err = newExtractorFromFlags()
+	c.Check(err, ErrorMatches, `invalid --add-location "lines", must be one of: full, file, never`)
+}
+
 func (s *xgettextTestSuite) TestWriteOutputNoLocation(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				fname: "fname",
@@ -241,9 +525,9 @@ func (s *xgettextTestSuite) TestWriteOutputNoLocation(c *C) {
 		},
 	}
 
-	*noLocation = true
+	s.e.AddLocation = locationNever
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 msgid   "foo"
@@ -254,7 +538,7 @@ msgstr  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputFormatHint(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				fname:      "fname",
@@ -265,7 +549,7 @@ func (s *xgettextTestSuite) TestWriteOutputFormatHint(c *C) {
 	}
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: fname:2
@@ -278,7 +562,7 @@ msgstr  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputPlural(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo": []msgID{
 			{
 				msgidPlural: "plural",
@@ -289,7 +573,7 @@ func (s *xgettextTestSuite) TestWriteOutputPlural(c *C) {
 	}
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: fname:2
@@ -303,7 +587,7 @@ msgstr[1]  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputSorted(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"aaa": []msgID{
 			{
 				fname: "fname",
@@ -318,12 +602,12 @@ func (s *xgettextTestSuite) TestWriteOutputSorted(c *C) {
 		},
 	}
 
-	*sortOutput = true
+	s.e.SortBy = "msgid"
 	// we need to run this a bunch of times as the ordering might
 	// be right by pure chance
 	for i := 0; i < 10; i++ {
 		out := bytes.NewBuffer([]byte(""))
-		writePotFile(out)
+		c.Assert(s.e.Write(out), IsNil)
 
 		expected := fmt.Sprintf(`%s
 #: fname:2
@@ -407,10 +691,10 @@ func main() {
     i18n.G("foo\n" + "bar\n" + "baz")
 }
 `))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
-	c.Assert(msgIDs, DeepEquals, map[string][]msgID{
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
 		"foo\\nbar\\nbaz": []msgID{
 			{
 				comment: "#. TRANSLATORS: foo comment\n",
@@ -421,6 +705,48 @@ func main() {
 	})
 }
 
+func (s *xgettextTestSuite) TestProcessFilesConst(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import m "example.com/app/msgs"
+
+func main() {
+    i18n.G(greeting)
+    i18n.G(chained + " world")
+    i18n.G(m.Title)
+    i18n.G(count)
+}
+`))
+	constsFname := filepath.Join(c.MkDir(), "consts.go")
+	err := ioutil.WriteFile(constsFname, []byte(`package main
+
+const (
+	greeting = "Hello"
+	chained  = greeting
+	count    = 3
+)
+`), 0644)
+	c.Assert(err, IsNil)
+	msgsFname := filepath.Join(c.MkDir(), "msgs.go")
+	err = ioutil.WriteFile(msgsFname, []byte(`package msgs
+
+const Title = "Title"
+`), 0644)
+	c.Assert(err, IsNil)
+
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname, constsFname, msgsFname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Unable to obtain value at %s:9:5: not a string constant: main.count\n", fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Hello":       []msgID{{fname: fname, line: 6}},
+		"Hello world": []msgID{{fname: fname, line: 7}},
+		"Title":       []msgID{{fname: fname, line: 8}},
+	})
+}
+
 func (s *xgettextTestSuite) TestProcessFilesWithQuote(c *C) {
 	fname := makeGoSourceFile(c, []byte(fmt.Sprintf(`package main
 
@@ -428,11 +754,11 @@ func main() {
     i18n.G(%[1]s foo "bar"%[1]s)
 }
 `, "`")))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: %[2]s:4
@@ -445,7 +771,7 @@ msgstr  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputMultilines(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo\\nbar\\nbaz": []msgID{
 			{
 				fname:   "fname",
@@ -455,7 +781,7 @@ func (s *xgettextTestSuite) TestWriteOutputMultilines(c *C) {
 		},
 	}
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 	expected := fmt.Sprintf(`%s
 #. foo
 #: fname:2
@@ -469,7 +795,7 @@ msgstr  ""
 }
 
 func (s *xgettextTestSuite) TestWriteOutputTidy(c *C) {
-	msgIDs = map[string][]msgID{
+	s.e.msgIDs = map[string][]msgID{
 		"foo\\nbar\\nbaz": []msgID{
 			{
 				fname: "fname",
@@ -484,7 +810,7 @@ func (s *xgettextTestSuite) TestWriteOutputTidy(c *C) {
 		},
 	}
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 	expected := fmt.Sprintf(`%s
 #: fname:2
 msgid   "foo\n"
@@ -507,11 +833,11 @@ func main() {
     i18n.G("foo \"bar\"")
 }
 `))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: %[2]s:4
@@ -530,12 +856,12 @@ func main() {
     i18n.G("arg-to-skip", "foo")
 }
 `))
-	*skipArgs = 1
-	err := processFiles([]string{fname})
+	s.e.Keywords["i18n.G"].SkipArgs = 1
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: %[2]s:4
@@ -554,11 +880,11 @@ func main() {
     i18n.CG("ctx1", "foo")
 }
 `))
-	err := processFiles([]string{fname})
+	err := s.e.Extract([]string{fname})
 	c.Assert(err, IsNil)
 
 	out := bytes.NewBuffer([]byte(""))
-	writePotFile(out)
+	c.Assert(s.e.Write(out), IsNil)
 
 	expected := fmt.Sprintf(`%s
 #: %[2]s:4
@@ -570,3 +896,3350 @@ msgstr  ""
 	c.Check(out.String(), Equals, expected)
 
 }
+
+func (s *xgettextTestSuite) TestMsgidDomainPrefix(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("Submit")
+    i18n.DG("Submit")
+    i18n.CG("button", "Submit")
+}
+`))
+	s.e.Keywords["i18n.DG"] = &keywordDef{Type: kTypeSingular, Name: "i18n.DG", Domain: "ui"}
+	s.e.Domain = "app"
+	s.e.MsgidDomainPrefix = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+#: %[2]s:4
+msgctxt "app"
+msgid   "Submit"
+msgstr  ""
+
+#: %[2]s:6
+msgctxt "app\004button"
+msgid   "Submit"
+msgstr  ""
+
+#: %[2]s:5
+msgctxt "ui"
+msgid   "Submit"
+msgstr  ""
+
+`, header, fname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputRevisionDate(c *C) {
+	s.e.msgIDs = map[string][]msgID{}
+	s.e.RevisionDate = true
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*"PO-Revision-Date: 2015-06-30 14:48\+0200\\n".*`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputRevisionDateFromGit(c *C) {
+	var gitArgs []string
+	oldRunGit := runGit
+	runGit = func(args ...string) (string, error) {
+		gitArgs = args
+		return "2016-02-03T10:20:30+01:00", nil
+	}
+	defer func() { runGit = oldRunGit }()
+
+	s.e.msgIDs = map[string][]msgID{}
+	s.e.processedFiles = []string{"a.go", "b.go"}
+	s.e.RevisionDateFromGit = true
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*"PO-Revision-Date: 2016-02-03 10:20\+0100\\n".*`)
+	c.Check(gitArgs, DeepEquals, []string{"log", "-1", "--format=%cI", "--", "a.go", "b.go"})
+}
+
+func (s *xgettextTestSuite) TestWriteOutputGitDiagnostics(c *C) {
+	oldRunGit := runGit
+	runGit = func(args ...string) (string, error) {
+		return "", fmt.Errorf("not a git repository")
+	}
+	defer func() { runGit = oldRunGit }()
+
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{{fname: "fname", line: 2}},
+	}
+	s.e.RevisionDateFromGit = true
+	s.e.AddMetadata = true
+	diagnostics := bytes.NewBuffer([]byte(""))
+	s.e.DiagnosticsFormat = "json"
+	s.e.DiagnosticsOutput = diagnostics
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(diagnostics.String(), Equals, `{"file":"","severity":"warning","code":"git-revision-date","message":"Unable to obtain git revision date: not a git repository"}
+{"file":"fname","severity":"warning","code":"git-metadata","message":"Unable to obtain git metadata for fname: not a git repository"}
+`)
+
+	// like other diagnostics these can be suppressed
+	s.e.IgnoreErrorsIn = []string{"fname"}
+	diagnostics.Reset()
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(diagnostics.String(), Matches, `[^\n]*"git-revision-date"[^\n]*\n`)
+}
+
+func (s *xgettextTestSuite) TestExtractSQLComment(c *C) {
+	fname := makeGoSourceFile(c, []byte("package main\n\nconst q = `SELECT name,\n    -- i18n: \"Column Header\"\n    age FROM users`\n"))
+	s.e.ExtractSQLComment = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Column Header": []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestExtractEmbed(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import _ "embed"
+
+//go:embed help.txt
+var helpText string
+
+//go:embed *.txt
+var other string
+
+func main() {
+    i18n.G(helpText)
+    i18n.G(other)
+}
+`))
+	asset := filepath.Join(filepath.Dir(fname), "help.txt")
+	err := ioutil.WriteFile(asset, []byte("Usage: foo\n"), 0644)
+	c.Assert(err, IsNil)
+
+	s.e.ExtractEmbed = true
+	s.e.WarnDynamic = true
+	stderr := captureStderr(c, func() {
+		err = s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Dynamic message argument at %s:13:5: unknown constant: other\n", fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Usage: foo\\n": []msgID{{fname: asset, line: 1}},
+	})
+}
+
+func (s *xgettextTestSuite) TestExtractCobra(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+var cmd = &cobra.Command{
+	Use:   "run <file>",
+	// TRANSLATORS: short help
+	Short: "Run a file",
+	Long:  i18n.G("Run a file and wait"),
+	Args:  "not extracted",
+}
+`))
+	s.e.ExtractCobra = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+#. (cobra command field: Short)
+#. TRANSLATORS: short help
+#: %[2]s:6
+msgid   "Run a file"
+msgstr  ""
+
+#: %[2]s:7
+msgid   "Run a file and wait"
+msgstr  ""
+
+#. (cobra command field: Use)
+#: %[2]s:4
+msgid   "run <file>"
+msgstr  ""
+
+`, header, fname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestKeywordFields(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+var app = &cli.App{
+	Usage: "Manage snaps",
+	Name:  "not extracted",
+	Commands: []*cli.Command{
+		{Usage: "not extracted, no type"},
+		&cli.Command{Usage: "Install a snap"},
+	},
+}
+`))
+	keywordFields = stringList{"cli.App.Usage", "cli.Command.Usage"}
+	var err error
+	s.e.KeywordFields, err = parseKeywordFields(keywordFields)
+	c.Assert(err, IsNil)
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Manage snaps":   []msgID{{fname: fname, line: 4, autoComment: "#. (struct field: cli.App.Usage)\n"}},
+		"Install a snap": []msgID{{fname: fname, line: 8, autoComment: "#. (struct field: cli.Command.Usage)\n"}},
+	})
+
+	_, err = parseKeywordFields([]string{"Usage"})
+	c.Check(err, ErrorMatches, `invalid keyword field "Usage", expected TYPE.FIELD`)
+}
+
+func (s *xgettextTestSuite) TestFindCommentsForTranslationBlankLine(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    // TRANSLATORS: not for foo
+
+    i18n.G("foo")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname: fname,
+				line:  6,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestAddCommentsTags(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    // translators: lower case
+    i18n.G("foo")
+    // i18n the tag without colon
+    i18n.G("bar")
+    // doc comment of the call
+    // TRANSLATORS: from the tag on
+    i18n.G("baz")
+    // i18nized is not the tag
+    i18n.G("qux")
+}
+`))
+	addCommentsTags = stringList{"TRANSLATORS:,i18n"}
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.AddCommentsTags, DeepEquals, []string{"TRANSLATORS:", "i18n"})
+	err = e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{{fname: fname, line: 5, comment: "#. translators: lower case\n"}},
+		"bar": []msgID{{fname: fname, line: 7, comment: "#. i18n the tag without colon\n"}},
+		"baz": []msgID{{fname: fname, line: 10, comment: "#. TRANSLATORS: from the tag on\n"}},
+		"qux": []msgID{{fname: fname, line: 12}},
+	})
+}
+
+func (s *xgettextTestSuite) TestFindCommentsForTranslationMultiLine(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    // TRANSLATORS: first line
+    /* second line
+       third line */
+    i18n.G("foo")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				comment: "#. TRANSLATORS: first line\n#. second line\n#. third line\n",
+				fname:   fname,
+				line:    7,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestOutputBOM(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	outName := filepath.Join(c.MkDir(), "snappy.pot")
+	os.Args = []string{"test-binary", "--output", outName, "--output-bom", fname}
+	main()
+
+	got, err := ioutil.ReadFile(outName)
+	c.Assert(err, IsNil)
+	c.Check(strings.HasPrefix(string(got), "\xEF\xBB\xBF# SOME DESCRIPTIVE TITLE."), Equals, true)
+
+	os.Args = []string{"test-binary", "--output", outName, "--output-bom", "--no-output-bom", fname}
+	main()
+
+	got, err = ioutil.ReadFile(outName)
+	c.Assert(err, IsNil)
+	c.Check(strings.HasPrefix(string(got), "# SOME DESCRIPTIVE TITLE."), Equals, true)
+}
+
+func (s *xgettextTestSuite) TestKeywordFormat(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.Logf("no verbs yet")
+}
+`))
+	*keywordFormat = "i18n.Logf"
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"no verbs yet": []msgID{
+			{
+				fname:      fname,
+				line:       4,
+				formatHint: "go-format",
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordFormatOverride(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.Errorf("cannot open file")
+    i18n.Percent("100% done")
+    i18n.Auto("%d files")
+}
+`))
+	s.e.Keywords["i18n.Errorf"] = &keywordDef{Type: kTypeSingular, Name: "i18n.Errorf", Format: "go-format"}
+	s.e.Keywords["i18n.Percent"] = &keywordDef{Type: kTypeSingular, Name: "i18n.Percent", Format: "no-format"}
+	s.e.Keywords["i18n.Auto"] = &keywordDef{Type: kTypeSingular, Name: "i18n.Auto", Format: "auto"}
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"cannot open file": []msgID{{fname: fname, line: 4, formatHint: "go-format"}},
+		"100% done":        []msgID{{fname: fname, line: 5, formatHint: "no-c-format"}},
+		"%d files":         []msgID{{fname: fname, line: 6, formatHint: "c-format"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordAutoComment(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    // TRANSLATORS: save the document
+    ui.Button("Save")
+}
+`))
+	s.e.Keywords["ui.Button"] = &keywordDef{Type: kTypeSingular, Name: "ui.Button", AutoComment: "This is a button label"}
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	expected := fmt.Sprintf(`%s
+#. This is a button label
+#. TRANSLATORS: save the document
+#: %s:5
+msgid   "Save"
+msgstr  ""
+
+`, header, fname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestPresetGotext(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    gotext.Get("hello")
+    gotext.GetC("Open", "menu")
+    gotext.GetND("errors", "file", "files", n)
+    gotext.GetNDC("errors", "disk", "disks", n, "hardware")
+}
+`))
+	presets = stringList{"gotext"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"hello":            []msgID{{fname: fname, line: 4}},
+		"menu\x04Open":     []msgID{{fname: fname, line: 5, msgctxt: "menu"}},
+		"file":             []msgID{{fname: fname, line: 6, msgidPlural: "files", domain: "errors"}},
+		"hardware\x04disk": []msgID{{fname: fname, line: 7, msgctxt: "hardware", msgidPlural: "disks"}},
+	})
+
+	presets = stringList{"no-such-lib"}
+	_, err = parseKeywords()
+	c.Check(err, ErrorMatches, `unknown preset "no-such-lib", expected one of: go-i18n, gotext, leonelquinteros, snapcore`)
+}
+
+func (s *xgettextTestSuite) TestPresetGoI18n(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+var files = &i18n.Message{
+	ID:    "Files",
+	One:   "{{.Count}} file",
+	Other: "{{.Count}} files",
+}
+
+var hello = &i18n.Message{
+	ID:    "Hello",
+	Other: "Hello world",
+}
+`))
+	preset := keywordPresets["go-i18n"]
+	var err error
+	s.e.KeywordFields, err = parseKeywordFields(preset.fields)
+	c.Assert(err, IsNil)
+	s.e.PluralFields = preset.pluralFields
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"{{.Count}} file": []msgID{{fname: fname, line: 5, msgidPlural: "{{.Count}} files", autoComment: "#. (struct field: i18n.Message.One)\n"}},
+		"Hello world":     []msgID{{fname: fname, line: 11, autoComment: "#. (struct field: i18n.Message.Other)\n"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordImportAlias(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import gt "github.com/leonelquinteros/gotext"
+
+func main() {
+    gt.Get("foo")
+}
+`))
+	keywordSpecs = stringList{"gotext.Get"}
+	keywordImportAliases = stringList{"github.com/leonelquinteros/gotext:gt"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname: fname,
+				line:  6,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestParseImportAliasesMajorVersion(c *C) {
+	aliases, err := parseImportAliases([]string{
+		"example.com/lib/v2:l",
+		"gopkg.in/gotext.v1:gt",
+		"example.com/lib.v2:dotted",
+	})
+	c.Assert(err, IsNil)
+	c.Check(aliases, DeepEquals, map[string]string{
+		"l":  "lib",
+		"gt": "gotext",
+		// only gopkg.in uses the .vN suffix
+		"dotted": "lib.v2",
+	})
+}
+
+func (s *xgettextTestSuite) TestExtractImportMajorVersion(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import "example.com/msgs/v2"
+
+func main() {
+    i18n.G(msgs.Title)
+}
+`))
+	msgsFname := filepath.Join(c.MkDir(), "msgs.go")
+	err := ioutil.WriteFile(msgsFname, []byte(`package msgs
+
+const Title = "Title"
+`), 0644)
+	c.Assert(err, IsNil)
+
+	err = s.e.Extract([]string{fname, msgsFname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Title": []msgID{{fname: fname, line: 6}},
+	})
+}
+
+func (s *xgettextTestSuite) TestParseImportAliasesError(c *C) {
+	_, err := parseImportAliases([]string{"gotext"})
+	c.Assert(err, ErrorMatches, `invalid import alias "gotext", expected PATH:ALIAS`)
+}
+
+func (s *xgettextTestSuite) TestFormatLanguageTeam(c *C) {
+	c.Check(s.e.formatLanguageTeam(), Equals, "LANGUAGE <LL@li.org>")
+
+	s.e.Language = "de"
+	c.Check(s.e.formatLanguageTeam(), Equals, "de")
+
+	s.e.TranslationURL = "https://translate.example.com/de/"
+	c.Check(s.e.formatLanguageTeam(), Equals, "de <https://translate.example.com/de/>")
+
+	s.e.LanguageTeam = "German <de@example.com>"
+	c.Check(s.e.formatLanguageTeam(), Equals, "German <de@example.com>")
+
+	s.e.msgIDs = map[string][]msgID{}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*"Language-Team: German <de@example.com>\\n"\n        "Language: de\\n".*`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputCopyright(c *C) {
+	s.e.msgIDs = map[string][]msgID{}
+
+	s.e.CopyrightHolder = "Canonical Ltd"
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, "(?s).*\n# Copyright \\(C\\) 2015 Canonical Ltd\n.*")
+
+	s.e.CopyrightYear = 2012
+	s.e.Charset = ""
+	out = bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, "(?s).*\n# Copyright \\(C\\) 2012 Canonical Ltd\n.*charset=CHARSET.*")
+}
+
+func (s *xgettextTestSuite) TestWriteOutputHeaderFields(c *C) {
+	*packageVersion = "2.1"
+	*foreignUser = true
+	headerFields = stringList{"Last-Translator=Jane Doe <jane@example.com>", "X-Generator = go-xgettext"}
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	e.msgIDs = map[string][]msgID{}
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `# SOME DESCRIPTIVE TITLE.
+# This file is put in the public domain.
+# FIRST AUTHOR <EMAIL@ADDRESS>, YEAR.
+#
+#, fuzzy
+msgid   ""
+msgstr  "Project-Id-Version: snappy 2.1\\n"
+(?s:.*)        "Last-Translator: Jane Doe <jane@example.com>\\n"
+(?s:.*)        "Content-Transfer-Encoding: 8bit\\n"
+        "X-Generator: go-xgettext\\n"
+
+`)
+
+	headerFields = stringList{"X-Generator"}
+	_, err = newExtractorFromFlags()
+	c.Check(err, ErrorMatches, `invalid header field "X-Generator", must be KEY=VALUE`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputCreationDate(c *C) {
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	*copyrightHolder = "Canonical Ltd"
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	e.msgIDs = map[string][]msgID{}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*# Copyright \(C\) 2023 Canonical Ltd\n.*"POT-Creation-Date: 2023-11-14 22:13\+0000\\n"\n.*`)
+
+	// the option takes precedence over the environment
+	*creationDate = "2020-01-02 03:04+0100"
+	e, err = newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.formatCreationDate(), Equals, "2020-01-02 03:04+0100")
+
+	*noDate = true
+	e, err = newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	e.msgIDs = map[string][]msgID{}
+	out.Reset()
+	c.Assert(e.Write(out), IsNil)
+	c.Check(strings.Contains(out.String(), "POT-Creation-Date"), Equals, false)
+
+	*creationDate = ""
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = newExtractorFromFlags()
+	c.Check(err, ErrorMatches, `invalid SOURCE_DATE_EPOCH "yesterday"`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputOmitHeader(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{{fname: "fname", line: 2}},
+	}
+	s.e.OmitHeader = true
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, `#: fname:2
+msgid   "foo"
+msgstr  ""
+
+`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputOmitHeaderEmpty(c *C) {
+	s.e.msgIDs = map[string][]msgID{}
+	s.e.OmitHeader = true
+	*outputBOM = true
+
+	fname := filepath.Join(c.MkDir(), "empty.pot")
+	c.Assert(writeOutput(s.e, outputSpec{format: "pot", fname: fname}), IsNil)
+	data, err := ioutil.ReadFile(fname)
+	c.Assert(err, IsNil)
+	c.Check(data, HasLen, 0)
+
+	// the byte order mark is only written with content
+	s.e.msgIDs["foo"] = []msgID{{fname: "fname", line: 2}}
+	c.Assert(writeOutput(s.e, outputSpec{format: "pot", fname: fname}), IsNil)
+	data, err = ioutil.ReadFile(fname)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, utf8BOM+`#: fname:2
+msgid   "foo"
+msgstr  ""
+
+`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputOnlyIfChanged(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{{fname: "fname", line: 2}},
+	}
+	*onlyIfChanged = true
+	fname := filepath.Join(c.MkDir(), "out.pot")
+	c.Assert(writeOutput(s.e, outputSpec{format: "pot", fname: fname}), IsNil)
+	old := time.Now().Add(-time.Hour)
+	c.Assert(os.Chtimes(fname, old, old), IsNil)
+
+	// a new creation date alone does not change the file
+	formatTime = func() string {
+		return "2016-01-01 00:00+0000"
+	}
+	c.Assert(writeOutput(s.e, outputSpec{format: "pot", fname: fname}), IsNil)
+	st, err := os.Stat(fname)
+	c.Assert(err, IsNil)
+	c.Check(st.ModTime().Equal(old), Equals, true)
+	data, err := ioutil.ReadFile(fname)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `(?s).*"POT-Creation-Date: 2015-06-30 14:48\+0200\\n".*`)
+
+	s.e.msgIDs["bar"] = []msgID{{fname: "fname", line: 3}}
+	c.Assert(writeOutput(s.e, outputSpec{format: "pot", fname: fname}), IsNil)
+	data, err = ioutil.ReadFile(fname)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `(?s).*"POT-Creation-Date: 2016-01-01 00:00\+0000\\n".*msgid   "bar".*`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputNoFuzzy(c *C) {
+	s.e.msgIDs = map[string][]msgID{}
+	s.e.NoFuzzy = true
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, strings.Replace(header, "#, fuzzy\n", "", 1)+"\n")
+}
+
+func (s *xgettextTestSuite) TestProcessFilesParenConcat(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G(("very long string " +
+        ("continuation")))
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"very long string continuation": []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestProcessFilesMixedQuotingConcat(c *C) {
+	fname := makeGoSourceFile(c, []byte("package main\n\nfunc main() {\n"+
+		"    i18n.G((\"Hello, \" +\n"+
+		"        `\"quoted\" ` +\n"+
+		"        (\"world\\t\" + `C:\\path`)) +\n"+
+		"        \"\\u00e9\")\n"+
+		"}\n"))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		`Hello, \"quoted\" world\tC:\\pathé`: []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestContextualKey(c *C) {
+	c.Check(s.e.contextualKey("", "foo"), Equals, "foo")
+	c.Check(s.e.contextualKey("ctx", "foo"), Equals, "ctx\x04foo")
+
+	s.e.ContextualKeySeparator = "::"
+	c.Check(s.e.contextualKey("ctx", "foo"), Equals, "ctx::foo")
+
+	// the JSON output identifies entries by the key
+	s.e.msgIDs = map[string][]msgID{
+		"menu\x04Open": []msgID{{msgctxt: "menu", fname: "fname", line: 2}},
+	}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.WriteJSON(out), IsNil)
+	c.Check(out.String(), Matches, `(?s)\[\s+\{\s+"key": "menu::Open",\s+"msgctxt": "menu",.*`)
+}
+
+func (s *xgettextTestSuite) TestWarnPluralWithoutN(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.NG("item", "items", n)
+    i18n.NG("file", "files")
+}
+`))
+	s.e.WarnPluralWithoutN = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Plural call without count argument at %s:5:5\n", fname))
+	c.Check(s.e.msgIDs, HasLen, 2)
+}
+
+func (s *xgettextTestSuite) TestIgnoreErrorsIn(c *C) {
+	src := []byte(`package main
+
+func main() {
+    i18n.NG("file", "files")
+}
+`)
+	fname := makeGoSourceFile(c, src)
+	legacyFname := filepath.Join(c.MkDir(), "legacy.go")
+	err := ioutil.WriteFile(legacyFname, src, 0644)
+	c.Assert(err, IsNil)
+
+	s.e.WarnPluralWithoutN = true
+	s.e.IgnoreErrorsIn = []string{"legacy*.go"}
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname, legacyFname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Plural call without count argument at %s:4:5\n", fname))
+	c.Check(s.e.msgIDs["file"], HasLen, 2)
+
+	ignoreErrorsIn = stringList{"["}
+	_, err = newExtractorFromFlags()
+	c.Assert(err, ErrorMatches, `invalid --ignore-errors-in pattern "\[": syntax error in pattern`)
+}
+
+func (s *xgettextTestSuite) TestDetectFormatHint(c *C) {
+	var tests = []struct {
+		in  []string
+		out string
+	}{
+		{in: []string{"no verbs"}, out: ""},
+		{in: []string{"100%% done"}, out: ""},
+		{in: []string{"%s has %d files"}, out: "c-format"},
+		{in: []string{"%5.2f%%"}, out: "c-format"},
+		{in: []string{"50% off"}, out: ""},
+		{in: []string{"100% sure"}, out: ""},
+		{in: []string{"100% sure, % d left"}, out: "c-format"},
+		{in: []string{"got %v"}, out: "go-format"},
+		{in: []string{"%+v"}, out: "go-format"},
+		{in: []string{"type %T"}, out: "go-format"},
+		{in: []string{"failed: %w"}, out: "go-format"},
+		{in: []string{"%[2]s %[1]s"}, out: "go-format"},
+		{in: []string{"%d file", "%d files: %v"}, out: "go-format"},
+	}
+
+	for _, test := range tests {
+		c.Check(detectFormatHint(test.in...), Equals, test.out, Commentf("%q", test.in))
+	}
+}
+
+func (s *xgettextTestSuite) TestFormatHint(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("got %v")
+    i18n.G("got %s")
+    i18n.G("100%%")
+}
+`))
+	for _, test := range []struct {
+		formatHint string
+		hints      map[string]string
+	}{
+		{"auto", map[string]string{"got %v": "go-format", "got %s": "c-format", "100%%": ""}},
+		{"go-format", map[string]string{"got %v": "go-format", "got %s": "go-format", "100%%": ""}},
+		{"no-hint", map[string]string{"got %v": "", "got %s": "", "100%%": ""}},
+	} {
+		s.e.FormatHint = test.formatHint
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+		for msgid, hint := range test.hints {
+			c.Check(s.e.msgIDs[msgid][0].formatHint, Equals, hint, Commentf("%s: %s", test.formatHint, msgid))
+		}
+	}
+
+	*formatHint = "rust-format"
+	_, err := newExtractorFromFlags()
+	c.Assert(err, ErrorMatches, `unknown format hint "rust-format"`)
+}
+
+func (s *xgettextTestSuite) TestWarnPluralFormat(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.NG("Found %d item", "Found %d items", n)
+    i18n.NG("one item", "%d items", n)
+    i18n.NG("%s has %d file", "%[1]s has %-3[2]d files", n)
+    i18n.NG("100%% done in %s", "100%% done in %d", n)
+}
+`))
+	s.e.WarnPluralFormat = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf(`WARN: Plural strings use different format verbs at %[1]s:5:5: "one item" and "%%d items"
+WARN: Plural strings use different format verbs at %[1]s:7:5: "100%%%% done in %%s" and "100%%%% done in %%d"
+`, fname))
+}
+
+func (s *xgettextTestSuite) TestFormatVerbs(c *C) {
+	c.Check(formatVerbs("no verbs"), HasLen, 0)
+	c.Check(formatVerbs("100%% %s"), DeepEquals, []string{"s"})
+	c.Check(formatVerbs("%[2]d %-5.2f %q"), DeepEquals, []string{"d", "f", "q"})
+	c.Check(formatVerbs("50% off, %d left"), DeepEquals, []string{"d"})
+}
+
+func (s *xgettextTestSuite) TestValidateMsgIDs(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("Save")
+    i18n.NG("Save", "Saves", n)
+    i18n.NG("file", "files", n)
+    i18n.NG("file", "files", n)
+    i18n.NG("file", "filez", n)
+    i18n.CG("menu", "Save")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	// singular and plural uses are merged
+	c.Check(s.e.msgIDs["Save"], DeepEquals, []msgID{
+		{fname: fname, line: 4, msgidPlural: "Saves"},
+		{fname: fname, line: 5, msgidPlural: "Saves"},
+	})
+	// the contextual use is an entry of its own, but reported
+	c.Check(validateMsgIDs(s.e.msgIDs), DeepEquals, []string{
+		fmt.Sprintf(`msgid "Save" has conflicting msgctxt "" at %[1]s:4 and "menu" at %[1]s:9`, fname),
+		fmt.Sprintf(`msgid "file" has conflicting msgid_plural "files" at %[1]s:6 and "filez" at %[1]s:8`, fname),
+	})
+}
+
+func (s *xgettextTestSuite) TestValidateMsgIDsContexts(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.CG("menu", "Open")
+    i18n.CG("toolbar", "Open")
+    i18n.CG("menu", "Open")
+    i18n.CG("menu", "Close")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Check(validateMsgIDs(s.e.msgIDs), DeepEquals, []string{
+		fmt.Sprintf(`msgid "Open" has conflicting msgctxt "menu" at %[1]s:4 and "toolbar" at %[1]s:5`, fname),
+	})
+}
+
+func (s *xgettextTestSuite) TestWriteResx(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo <bar>": []msgID{
+			{
+				fname: "fname",
+				line:  2,
+			},
+		},
+		"file": []msgID{
+			{
+				msgidPlural: "files",
+				fname:       "fname",
+				line:        4,
+			},
+		},
+		"open": []msgID{
+			{
+				msgctxt: "menu",
+				fname:   "fname",
+				line:    6,
+			},
+		},
+	}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.WriteResx(out), IsNil)
+
+	expected := resxHeader + `  <data name="file_one" xml:space="preserve">
+    <value></value>
+  </data>
+  <data name="file_other" xml:space="preserve">
+    <value></value>
+  </data>
+  <data name="foo &lt;bar&gt;" xml:space="preserve">
+    <value></value>
+  </data>
+  <data name="menu.open" xml:space="preserve">
+    <value></value>
+  </data>
+</root>
+`
+	c.Assert(out.String(), Equals, expected)
+}
+
+const testPoFile = `# German translation
+msgid   ""
+msgstr  "Project-Id-Version: snappy\n"
+        "Language: de\n"
+
+#: foo.go:2
+msgid   "foo"
+msgstr  "Foo"
+
+#: foo.go:4 bar.go:6
+msgid   "bar"
+msgstr  ""
+
+#: foo.go:8
+msgctxt "menu"
+msgid   "file"
+msgid_plural   "files"
+msgstr[0]  "Datei"
+msgstr[1]  "Dateien"
+
+#: foo.go:10
+#, fuzzy
+msgid   "baz"
+msgstr  "Baz"
+`
+
+func (s *xgettextTestSuite) TestWriteJSON(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo \\\"bar\\\"": []msgID{
+			{
+				comment: "#. TRANSLATORS: quoted\n",
+				fname:   "fname",
+				line:    2,
+			},
+			{
+				fname: "other",
+				line:  7,
+			},
+		},
+		"menu\x04%d file": []msgID{
+			{
+				msgctxt:     "menu",
+				msgidPlural: "%d files",
+				formatHint:  "c-format",
+				fname:       "fname",
+				line:        4,
+			},
+		},
+	}
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.WriteJSON(out), IsNil)
+
+	var got []jsonMessage
+	err := json.Unmarshal(out.Bytes(), &got)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, []jsonMessage{
+		{
+			Key:         "menu\x04%d file",
+			Msgctxt:     "menu",
+			Msgid:       "%d file",
+			MsgidPlural: "%d files",
+			Locations:   []jsonLocation{{File: "fname", Line: 4}},
+			Format:      "c-format",
+		},
+		{
+			Key:      `foo "bar"`,
+			Msgid:    `foo "bar"`,
+			Comments: []string{"TRANSLATORS: quoted"},
+			Locations: []jsonLocation{
+				{File: "fname", Line: 2},
+				{File: "other", Line: 7},
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestParsePoFile(c *C) {
+	entries, err := parsePoFile(strings.NewReader(testPoFile))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 5)
+	c.Check(entries[0].isHeader(), Equals, true)
+	c.Check(entries[0].msgstr, DeepEquals, []string{`Project-Id-Version: snappy\nLanguage: de\n`})
+	c.Check(entries[3], DeepEquals, &poEntry{
+		references:  []string{"foo.go:8"},
+		msgctxt:     "menu",
+		msgid:       "file",
+		msgidPlural: "files",
+		msgstr:      []string{"Datei", "Dateien"},
+	})
+	c.Check(entries[4].isFuzzy(), Equals, true)
+}
+
+func (s *xgettextTestSuite) TestCheckCompleteness(c *C) {
+	out := bytes.NewBuffer([]byte(""))
+	percent, missing, err := checkCompleteness(strings.NewReader(testPoFile), out)
+	c.Assert(err, IsNil)
+	c.Check(percent, Equals, 50.0)
+	c.Check(missing, Equals, 2)
+	c.Check(out.String(), Equals, `missing translation for msgid "bar" at foo.go:4 bar.go:6
+missing translation for msgid "baz" at foo.go:10
+`)
+}
+
+const existingPotFile = `# SOME DESCRIPTIVE TITLE.
+#, fuzzy
+msgid   ""
+msgstr  "Project-Id-Version: snappy\\n"
+
+# keep this
+#: old.go:3
+#, fuzzy, c-format
+msgid   "foo %s"
+msgstr  ""
+
+#: old.go:5
+msgctxt "menu"
+msgid   "gone"
+msgstr  ""
+`
+
+func (s *xgettextTestSuite) TestParsePotFile(c *C) {
+	ids, err := parsePotFile(strings.NewReader(existingPotFile))
+	c.Assert(err, IsNil)
+	c.Check(ids, DeepEquals, map[string][]msgID{
+		"foo %s": []msgID{
+			{
+				translatorComment: "# keep this\n",
+				fuzzy:             true,
+				formatHint:        "c-format",
+				fname:             "old.go",
+				line:              3,
+			},
+		},
+		"menu\x04gone": []msgID{
+			{
+				msgctxt: "menu",
+				fname:   "old.go",
+				line:    5,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestJoinExisting(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo %s")
+    i18n.G("new")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	s.e.KeepObsolete = true
+	err = s.e.Join(strings.NewReader(existingPotFile))
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+# keep this
+#: %[2]s:4
+#, fuzzy, c-format
+msgid   "foo %%s"
+msgstr  ""
+
+#: %[2]s:5
+msgid   "new"
+msgstr  ""
+
+#~ msgctxt "menu"
+#~ msgid   "gone"
+#~ msgstr  ""
+
+`, header, fname)
+	c.Check(out.String(), Equals, expected)
+
+	// without --keep-obsolete the entry is dropped
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	s.e.KeepObsolete = false
+	err = s.e.Join(strings.NewReader(existingPotFile))
+	c.Assert(err, IsNil)
+	c.Check(s.e.obsoleteMsgIDs, HasLen, 0)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputAddMetadata(c *C) {
+	var gitCalls []string
+	oldRunGit := runGit
+	runGit = func(args ...string) (string, error) {
+		gitCalls = append(gitCalls, strings.Join(args, " "))
+		if args[0] == "blame" {
+			// the uncommitted line 6 and line 4 of a commit whose
+			// headers were listed before
+			return `1111111111111111111111111111111111111111 1 1 2
+author Jane Doe
+author-time 1705744800
+author-tz +0100
+summary Add foo
+filename fname
+	package main
+1111111111111111111111111111111111111111 2 2
+	foo
+2222222222222222222222222222222222222222 3 3 1
+author John Roe
+author-time 1705901400
+author-tz -0800
+summary Add bar
+filename fname
+	bar
+1111111111111111111111111111111111111111 4 4 1
+	baz
+0000000000000000000000000000000000000000 6 6 1
+author Not Committed Yet
+author-time 1705900000
+author-tz +0000
+filename fname
+	qux`, nil
+		}
+		return "2024-01-16 09:00:00 +0100\n2024-01-15 10:00:00 +0100", nil
+	}
+	defer func() { runGit = oldRunGit }()
+
+	s.e.msgIDs = map[string][]msgID{
+		"bar": []msgID{
+			{
+				fname: "fname",
+				line:  3,
+			},
+		},
+		"baz": []msgID{
+			{
+				fname: "fname",
+				line:  4,
+			},
+		},
+		"foo": []msgID{
+			{
+				fname:   "fname",
+				line:    2,
+				comment: "#. foo\n",
+			},
+		},
+		"qux": []msgID{
+			{
+				fname: "fname",
+				line:  6,
+			},
+		},
+	}
+	s.e.AddMetadata = true
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	// the dates are the ones of the author, John Roe committed on the
+	// 22nd in UTC
+	expected := fmt.Sprintf(`%s
+#. Added: 2024-01-15
+#. Last-modified: 2024-01-21
+#. Last-modifier: John Roe
+#: fname:3
+msgid   "bar"
+msgstr  ""
+
+#. Added: 2024-01-15
+#. Last-modified: 2024-01-20
+#. Last-modifier: Jane Doe
+#: fname:4
+msgid   "baz"
+msgstr  ""
+
+#. Added: 2024-01-15
+#. Last-modified: 2024-01-20
+#. Last-modifier: Jane Doe
+#. foo
+#: fname:2
+msgid   "foo"
+msgstr  ""
+
+#. Added: 2024-01-15
+#: fname:6
+msgid   "qux"
+msgstr  ""
+
+`, header)
+	c.Assert(out.String(), Equals, expected)
+	// results are cached per file
+	c.Check(gitCalls, DeepEquals, []string{
+		"log --diff-filter=A --format=%ai -- fname",
+		"blame --porcelain -- fname",
+	})
+}
+
+func (s *xgettextTestSuite) TestParseOutputSpecs(c *C) {
+	specs, err := parseOutputSpecs(nil, "")
+	c.Assert(err, IsNil)
+	c.Check(specs, DeepEquals, []outputSpec{{format: "pot"}})
+
+	specs, err = parseOutputSpecs([]string{"pot", "resx:messages.resx"}, "messages.pot")
+	c.Assert(err, IsNil)
+	c.Check(specs, DeepEquals, []outputSpec{
+		{format: "pot", fname: "messages.pot"},
+		{format: "resx", fname: "messages.resx"},
+	})
+
+	specs, err = parseOutputSpecs([]string{"pot:messages.pot,resx:messages.resx"}, "")
+	c.Assert(err, IsNil)
+	c.Check(specs, DeepEquals, []outputSpec{
+		{format: "pot", fname: "messages.pot"},
+		{format: "resx", fname: "messages.resx"},
+	})
+
+	_, err = parseOutputSpecs([]string{"xliff"}, "")
+	c.Check(err, ErrorMatches, `unknown output format "xliff"`)
+	_, err = parseOutputSpecs([]string{"pot", "resx"}, "")
+	c.Check(err, ErrorMatches, `more than one output format written to stdout`)
+}
+
+func (s *xgettextTestSuite) TestMultipleOutputFormats(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	dir := c.MkDir()
+	potName := filepath.Join(dir, "messages.pot")
+	resxName := filepath.Join(dir, "messages.resx")
+	os.Args = []string{"test-binary",
+		"--output-format", "pot:" + potName,
+		"--output-format", "resx:" + resxName,
+		fname,
+	}
+	main()
+
+	got, err := ioutil.ReadFile(potName)
+	c.Assert(err, IsNil)
+	c.Check(string(got), Matches, `(?s)# SOME DESCRIPTIVE TITLE.*msgid   "foo".*`)
+	got, err = ioutil.ReadFile(resxName)
+	c.Assert(err, IsNil)
+	c.Check(string(got), Matches, `(?s)<\?xml.*<data name="foo" xml:space="preserve">.*`)
+}
+
+func (s *xgettextTestSuite) TestExtractCobraFlags(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func init() {
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file path")
+	// TRANSLATORS: verbose flag
+	cmd.PersistentFlags().Bool("verbose", false, "Be verbose")
+	other.StringVar(&output, "other", "", "Not a cobra flag")
+}
+`))
+	s.e.ExtractCobraFlags = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Output file path": []msgID{
+			{
+				fname:       fname,
+				line:        4,
+				autoComment: "#. (cobra flag usage: --output)\n",
+			},
+		},
+		"Be verbose": []msgID{
+			{
+				fname:       fname,
+				line:        6,
+				comment:     "#. TRANSLATORS: verbose flag\n",
+				autoComment: "#. (cobra flag usage: --verbose)\n",
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestWriteOutputPluralFormsComment(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{
+			{
+				msgidPlural: "foos",
+				fname:       "fname",
+				line:        2,
+			},
+		},
+		"bar": []msgID{
+			{
+				fname: "fname",
+				line:  4,
+			},
+		},
+	}
+	s.e.AddPluralFormsComment = true
+	s.e.Language = "pl_PL.UTF-8"
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*
+#: fname:4
+msgid   "bar"
+msgstr  ""
+
+#. Plural-Forms: nplurals=3; plural=\(n==1 \? 0 : .*\);
+#: fname:2
+msgid   "foo"
+.*`)
+
+	s.e.Language = ""
+	c.Check(pluralFormsComment(s.e.Language), Equals, genericPluralFormsComment)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputPluralFormsSlots(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"file": []msgID{
+			{
+				msgidPlural: "files",
+				fname:       "fname",
+				line:        2,
+			},
+		},
+	}
+	headerWith := func(pluralForms string) string {
+		return strings.TrimSuffix(header, "\n") + "\n        \"Plural-Forms: " + pluralForms + "\\n\"\n"
+	}
+
+	s.e.PluralForms = 3
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, headerWith("nplurals=3; plural=EXPRESSION;")+`
+#: fname:2
+msgid   "file"
+msgid_plural   "files"
+msgstr[0]  ""
+msgstr[1]  ""
+msgstr[2]  ""
+
+`)
+
+	*pluralFormula = "nplurals=4; plural=(n==1 ? 0 : n==2 ? 1 : n<5 ? 2 : 3);"
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.PluralForms, Equals, 4)
+	e.msgIDs = s.e.msgIDs
+	out = bytes.NewBuffer([]byte(""))
+	c.Assert(e.Write(out), IsNil)
+	c.Check(strings.HasPrefix(out.String(), headerWith(*pluralFormula)), Equals, true)
+	c.Check(strings.Count(out.String(), "msgstr["), Equals, 4)
+
+	*pluralFormula = "plural=n != 1;"
+	_, err = newExtractorFromFlags()
+	c.Assert(err, ErrorMatches, `no nplurals in plural formula "plural=n != 1;"`)
+}
+
+func (s *xgettextTestSuite) TestLookupPluralForms(c *C) {
+	rule, ok := lookupPluralForms("pt_BR")
+	c.Check(ok, Equals, true)
+	c.Check(rule, Equals, "nplurals=2; plural=(n > 1);")
+	rule, ok = lookupPluralForms("pt-PT")
+	c.Check(ok, Equals, true)
+	c.Check(rule, Equals, "nplurals=2; plural=(n != 1);")
+	rule, ok = lookupPluralForms("ga_IE")
+	c.Check(ok, Equals, true)
+	c.Check(rule, Equals, "nplurals=5; plural=n==1 ? 0 : n==2 ? 1 : (n>2 && n<7) ? 2 : (n>6 && n<11) ? 3 : 4;")
+	_, ok = lookupPluralForms("xx")
+	c.Check(ok, Equals, false)
+}
+
+func (s *xgettextTestSuite) TestProcessFilesWithBOM(c *C) {
+	fname := makeGoSourceFile(c, []byte("\xEF\xBB\xBFpackage main\n\nfunc main() {\n    i18n.G(\"foo\")\n}\n"))
+	s.e.Verbose = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("NOTE: Stripped UTF-8 byte order mark from %s\n", fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestSortedMsgIDKeys(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"aaa": []msgID{{msgctxt: "menu", fname: "b.go", line: 3}},
+		"bbb": []msgID{{fname: "a.go", line: 7}},
+		"ccc": []msgID{{msgctxt: "menu", fname: "a.go", line: 2}},
+		"ddd": []msgID{{fname: "b.go", line: 1}},
+	}
+	s.e.processedFiles = []string{"b.go", "a.go"}
+
+	s.e.SortBy = "msgid"
+	c.Check(s.e.sortedMsgIDKeys(), DeepEquals, []string{"aaa", "bbb", "ccc", "ddd"})
+	s.e.SortBy = "context"
+	c.Check(s.e.sortedMsgIDKeys(), DeepEquals, []string{"bbb", "ddd", "aaa", "ccc"})
+	s.e.SortBy = "file"
+	c.Check(s.e.sortedMsgIDKeys(), DeepEquals, []string{"ccc", "bbb", "ddd", "aaa"})
+	s.e.SortBy = "occurrence"
+	c.Check(s.e.sortedMsgIDKeys(), DeepEquals, []string{"ddd", "aaa", "ccc", "bbb"})
+}
+
+func (s *xgettextTestSuite) TestSortByFile(c *C) {
+	*sortOutput = false
+	*sortByFile = true
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.SortBy, Equals, "file")
+
+	// entries are ordered by their first location, not the first
+	// occurrence
+	e.msgIDs = map[string][]msgID{
+		"aaa": []msgID{{fname: "b.go", line: 1}, {fname: "a.go", line: 9}},
+		"bbb": []msgID{{fname: "a.go", line: 5}},
+		"ccc": []msgID{{fname: "b.go", line: 3}, {fname: "b.go", line: 2}},
+	}
+	c.Check(e.sortedMsgIDKeys(), DeepEquals, []string{"bbb", "aaa", "ccc"})
+
+	*sortOutput = true
+	_, err = newExtractorFromFlags()
+	c.Check(err, ErrorMatches, "--sort-output and --sort-by-file are mutually exclusive")
+}
+
+func (s *xgettextTestSuite) TestMaxCommentLines(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    // TRANSLATORS: line 1
+    // line 2
+    // line 3
+    i18n.G("foo")
+}
+`))
+	s.e.MaxCommentLines = 2
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	// with tags the block starts at the tagged line
+	c.Assert(s.e.msgIDs["foo"][0].comment, Equals, "#. TRANSLATORS: line 1\n#. line 2\n")
+}
+
+func (s *xgettextTestSuite) TestMaxCommentLinesKeepsLinesNextToCall(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+// main does something, this doc comment
+// is not meant for translators
+func main() {
+    // line 1
+    // line 2
+    // line 3
+    i18n.G("foo")
+}
+`))
+	s.e.AddComments = true
+	s.e.AddCommentsTags = nil
+	s.e.MaxCommentLines = 2
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs["foo"][0].comment, Equals, "#. line 2\n#. line 3\n")
+}
+
+func (s *xgettextTestSuite) TestExtractGoGenerate(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+//go:generate mkbanner -title "Welcome to snappy"
+//go:generate stringer -type=Foo
+// not a directive -title "Ignored"
+`))
+	s.e.ExtractGoGenerate = regexp.MustCompile(`-title "([^"]*)"`)
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Welcome to snappy": []msgID{
+			{
+				fname: fname,
+				line:  3,
+			},
+		},
+	})
+
+	*extractGoGenerate = `(`
+	_, err = newExtractorFromFlags()
+	c.Assert(err, ErrorMatches, "error parsing regexp: .*")
+}
+
+func (s *xgettextTestSuite) TestWalkDir(c *C) {
+	root := c.MkDir()
+	for _, fname := range []string{"a.go", "a_test.go", "README", "sub/b.go", "sub/b_gen.go", "vendor/c.go", "sub/vendor/d.go"} {
+		fname = filepath.Join(root, fname)
+		err := os.MkdirAll(filepath.Dir(fname), 0755)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(fname, []byte("package main\n"), 0644)
+		c.Assert(err, IsNil)
+	}
+	join := func(fnames ...string) []string {
+		for i := range fnames {
+			fnames[i] = filepath.Join(root, fnames[i])
+		}
+		return fnames
+	}
+
+	files, err := walkDir(root, walkOptions{})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, join("a.go"))
+
+	files, err = walkDir(root, walkOptions{recursive: true})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, join("a.go", "sub/b.go", "sub/b_gen.go", "sub/vendor/d.go", "vendor/c.go"))
+
+	files, err = walkDir(root, walkOptions{recursive: true, includeTests: true, exclude: []string{"vendor", "*_gen.go"}})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, join("a.go", "a_test.go", "sub/b.go"))
+
+	files, err = walkDir(root, walkOptions{recursive: true, exclude: []string{"sub/*"}})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, join("a.go", "vendor/c.go"))
+
+	files, err = walkDir(root, walkOptions{recursive: true, include: []string{"sub/*"}})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, join("sub/b.go", "sub/b_gen.go"))
+
+	files, err = expandArgs([]string{root + "/...", "other.go"})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, append(join("a.go", "sub/b.go", "sub/b_gen.go"), "other.go"))
+}
+
+func (s *xgettextTestSuite) TestIntegrationRecursive(c *C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`), 0644)
+	c.Assert(err, IsNil)
+	outName := filepath.Join(c.MkDir(), "snappy.pot")
+	os.Args = []string{"test-binary", "--recursive", "--output", outName, dir}
+
+	main()
+
+	got, err := ioutil.ReadFile(outName)
+	c.Assert(err, IsNil)
+	c.Check(string(got), Matches, `(?s).*#: .*/foo.go:4\nmsgid   "foo"\n.*`)
+}
+
+func (s *xgettextTestSuite) TestBuildContext(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"all.go":           "package main\n",
+		"only_linux.go":    "package main\n",
+		"only_windows.go":  "package main\n",
+		"tagged.go":        "//go:build extra\n\npackage main\n",
+		"arm64_special.go": "//go:build arm64\n\npackage main\n",
+	}
+	var fnames []string
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		err := ioutil.WriteFile(fname, []byte(content+"\nfunc init() { i18n.G(\""+name+"\") }\n"), 0644)
+		c.Assert(err, IsNil)
+		fnames = append(fnames, fname)
+	}
+
+	*goos = "linux"
+	*goarch = "amd64"
+	*buildTags = "extra"
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Assert(e.BuildContext, NotNil)
+	s.e.BuildContext = e.BuildContext
+	err = s.e.Extract(fnames)
+	c.Assert(err, IsNil)
+
+	var found []string
+	for k := range s.e.msgIDs {
+		found = append(found, k)
+	}
+	sort.Strings(found)
+	c.Check(found, DeepEquals, []string{"all.go", "only_linux.go", "tagged.go"})
+}
+
+func (s *xgettextTestSuite) TestAllPlatforms(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"all.go":               "package main\n",
+		"only_windows.go":      "package main\n",
+		"tagged.go":            "//go:build linux || darwin\n\npackage main\n",
+		"both_linux.go":        "//go:build extra\n\npackage main\n",
+		"special_plan9_386.go": "package main\n",
+	}
+	var fnames []string
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		err := ioutil.WriteFile(fname, []byte(content+"\nfunc init() { i18n.G(\""+name+"\") }\n"), 0644)
+		c.Assert(err, IsNil)
+		fnames = append(fnames, fname)
+	}
+
+	s.e.AllPlatforms = true
+	err := s.e.Extract(fnames)
+	c.Assert(err, IsNil)
+
+	comments := make(map[string]string)
+	for k, msgids := range s.e.msgIDs {
+		comments[k] = msgids[0].autoComment
+	}
+	c.Check(comments, DeepEquals, map[string]string{
+		"all.go":               "",
+		"only_windows.go":      "#. (build constraint: windows)\n",
+		"tagged.go":            "#. (build constraint: linux || darwin)\n",
+		"both_linux.go":        "#. (build constraint: linux && extra)\n",
+		"special_plan9_386.go": "#. (build constraint: plan9 && 386)\n",
+	})
+}
+
+func (s *xgettextTestSuite) TestExtractErrors(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	brokenFname := filepath.Join(c.MkDir(), "broken.go")
+	err := ioutil.WriteFile(brokenFname, []byte("package main\n\nfunc {\n"), 0644)
+	c.Assert(err, IsNil)
+	missingFname := filepath.Join(c.MkDir(), "missing.go")
+
+	err = s.e.Extract([]string{fname, brokenFname})
+	c.Assert(err, ErrorMatches, `.*/broken.go:3:6: expected .*`)
+	err = s.e.Extract([]string{missingFname, fname})
+	c.Assert(err, ErrorMatches, `open .*/missing.go: no such file or directory`)
+
+	s.e.ContinueOnError = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{missingFname, brokenFname, fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Matches, `WARN: Skipping .*/missing.go: open .*
+WARN: Skipping .*/broken.go: .*
+`)
+	c.Check(s.e.processedFiles, DeepEquals, []string{fname})
+	c.Check(s.e.failedFiles, DeepEquals, []string{missingFname, brokenFname})
+	c.Check(s.e.msgIDs, HasLen, 1)
+}
+
+func (s *xgettextTestSuite) TestKeepGoingFlag(c *C) {
+	*keepGoing = true
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	c.Check(e.ContinueOnError, Equals, true)
+}
+
+func (s *xgettextTestSuite) TestLocationName(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	dir := filepath.Dir(fname)
+
+	for _, test := range []struct {
+		stripFilePrefix string
+		relativeTo      string
+		fname           string
+	}{
+		{"", "", fname},
+		{"/does/not/match/", "", fname},
+		{dir + "/", "", "foo.go"},
+		{"", filepath.Dir(dir), filepath.Join(filepath.Base(dir), "foo.go")},
+		{"/does/not/match/", dir, "foo.go"},
+	} {
+		s.e.StripFilePrefix = test.stripFilePrefix
+		s.e.RelativeTo = test.relativeTo
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+		c.Check(s.e.msgIDs["foo"][0].fname, Equals, test.fname)
+	}
+}
+
+func (s *xgettextTestSuite) TestReferencePrefixMap(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	dir := filepath.Dir(fname)
+	root := filepath.Dir(dir)
+	cwd, err := os.Getwd()
+	c.Assert(err, IsNil)
+	defer os.Chdir(cwd)
+	c.Assert(os.Chdir(root), IsNil)
+	relName := filepath.Join(filepath.Base(dir), "foo.go")
+
+	for _, test := range []struct {
+		strips []string
+		specs  []string
+		fname  string
+		name   string
+	}{
+		{[]string{root}, nil, fname, relName},
+		{[]string{root + "/"}, nil, relName, relName},
+		{[]string{root, dir}, nil, fname, "foo.go"},
+		{nil, []string{dir + "=src/pkg"}, fname, "src/pkg/foo.go"},
+		{nil, []string{dir + "=src/pkg"}, relName, "src/pkg/foo.go"},
+		// only whole directories match
+		{[]string{dir[:len(dir)-1]}, nil, fname, fname},
+	} {
+		referencePrefixStrip = test.strips
+		referencePrefixMap = test.specs
+		e, err := newExtractorFromFlags()
+		c.Assert(err, IsNil)
+		c.Assert(e.Extract([]string{test.fname}), IsNil)
+		c.Check(e.msgIDs["foo"][0].fname, Equals, test.name, Commentf("%v %v %s", test.strips, test.specs, test.fname))
+	}
+
+	referencePrefixStrip = nil
+	referencePrefixMap = stringList{"src"}
+	_, err = newExtractorFromFlags()
+	c.Check(err, ErrorMatches, `invalid --reference-prefix-map "src", must be OLD=NEW`)
+}
+
+func (s *xgettextTestSuite) TestSkipTests(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("foo")
+}
+`))
+	testFname := filepath.Join(filepath.Dir(fname), "foo_test.go")
+	err := ioutil.WriteFile(testFname, []byte(`package main
+
+func TestFoo() {
+    i18n.G("test string")
+}
+`), 0644)
+	c.Assert(err, IsNil)
+
+	s.e.SkipTests = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname, testFname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Skipping test file %s\n", testFname))
+	c.Check(s.e.processedFiles, DeepEquals, []string{fname})
+
+	// the test files of directories are skipped silently
+	*includeTests = true
+	*skipTests = true
+	files, err := expandArgs([]string{filepath.Dir(fname)})
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, []string{fname})
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestTestFileComment(c *C) {
+	testFname := filepath.Join(c.MkDir(), "foo_test.go")
+	err := ioutil.WriteFile(testFname, []byte(`package main
+
+func TestFoo() {
+    i18n.G("test string")
+}
+`), 0644)
+	c.Assert(err, IsNil)
+
+	err = s.e.Extract([]string{testFname})
+	c.Assert(err, IsNil)
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+#. (test file)
+#: %s:4
+msgid   "test string"
+msgstr  ""
+
+`, header, testFname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestParseKeywordSpec(c *C) {
+	zero, one, two, three := 0, 1, 2, 3
+	for _, test := range []struct {
+		spec string
+		def  *keywordDef
+		err  string
+	}{
+		{spec: "tr", def: &keywordDef{Type: kTypeSingular, Name: "tr", SkipArgs: 1}},
+		{spec: "tr:2", def: &keywordDef{Type: kTypeSingular, Name: "tr", MsgidArg: &one}},
+		{spec: "ngettext:1,2", def: &keywordDef{Type: kTypePlural, Name: "ngettext", MsgidArg: &zero, MsgidPluralArg: &one}},
+		{spec: "pgettext:1c,2", def: &keywordDef{Type: kTypeContextual, Name: "pgettext", MsgctxtArg: &zero, MsgidArg: &one}},
+		{spec: "npgettext:1c,2,3", def: &keywordDef{Type: kTypePluralContextual, Name: "npgettext", MsgctxtArg: &zero, MsgidArg: &one, MsgidPluralArg: &two}},
+		{spec: `tr:2,"menu, top"`, def: &keywordDef{Type: kTypeSingular, Name: "tr", MsgidArg: &one, AutoComment: "menu, top"}},
+		{spec: "dialog.New:1,2,4", def: &keywordDef{Type: kTypeSingular, Name: "dialog.New", MsgidArgs: []int{zero, one, three}}},
+		{spec: ":1", err: `invalid keyword ":1", missing name`},
+		{spec: "tr:0", err: `invalid keyword "tr:0", invalid argument position "0"`},
+		{spec: "tr:1c", err: `invalid keyword "tr:1c", missing msgid position`},
+		{spec: "tr:1,2t", err: `invalid keyword "tr:1,2t", argument counts like "2t" are not supported`},
+	} {
+		def, err := parseKeywordSpec(test.spec, 1)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, regexp.QuoteMeta(test.err), Commentf(test.spec))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf(test.spec))
+		c.Check(def, DeepEquals, test.def, Commentf(test.spec))
+	}
+}
+
+func (s *xgettextTestSuite) TestKeywordSpecsMixedSignatures(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    T(ctx, "single")
+    TN("one", "many", n)
+    TC(ctx, "menu", "Open")
+}
+`))
+	*skipArgs = 1
+	keywordSpecs = stringList{"", "T", "TN:1,2", "TC:2c,3"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"single":       []msgID{{fname: fname, line: 4}},
+		"one":          []msgID{{fname: fname, line: 5, msgidPlural: "many"}},
+		"menu\x04Open": []msgID{{fname: fname, line: 6, msgctxt: "menu"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordSpecs(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    gettext.Gettext("default")
+    tr.P("menu", "Open")
+}
+`))
+	keywordSpecs = stringList{`tr.P:1c,2,"menu item"`}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"default":      []msgID{{fname: fname, line: 4}},
+		"menu\x04Open": []msgID{{fname: fname, line: 5, msgctxt: "menu", autoComment: "#. menu item\n"}},
+	})
+
+	// an empty value disables the defaults
+	keywordSpecs = stringList{"", "tr.G"}
+	k, err = parseKeywords()
+	c.Assert(err, IsNil)
+	c.Check(k, DeepEquals, keywords{"tr.G": {Type: kTypeSingular, Name: "tr.G"}})
+}
+
+func (s *xgettextTestSuite) TestNoDefaultKeywords(c *C) {
+	keywordSpecs = stringList{"tr.G"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	c.Check(k["gettext.Gettext"], NotNil)
+
+	*noDefaultKeywords = true
+	k, err = parseKeywords()
+	c.Assert(err, IsNil)
+	c.Check(k, DeepEquals, keywords{"tr.G": {Type: kTypeSingular, Name: "tr.G"}})
+
+	// the user keywords of the other options are kept
+	keywordSpecs = nil
+	*keywordPlural = "tr.NG"
+	presets = stringList{"snapcore"}
+	k, err = parseKeywords()
+	c.Assert(err, IsNil)
+	c.Check(k["gettext.Gettext"], IsNil)
+	c.Check(k["tr.NG"], DeepEquals, &keywordDef{Type: kTypePlural, Name: "tr.NG"})
+	c.Check(k["i18n.G"], NotNil)
+}
+
+func (s *xgettextTestSuite) TestKeywordArity(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    MyT(ctx, "foo")
+    MyNT(ctx, "bar", "bars", n)
+}
+`))
+	keywordArities = stringList{"MyT:singular:0:1", "MyNT:plural:0:1:2"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{
+			{
+				fname: fname,
+				line:  4,
+			},
+		},
+		"bar": []msgID{
+			{
+				msgidPlural: "bars",
+				fname:       fname,
+				line:        5,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgSchema(c *C) {
+	var schema struct {
+		Items struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"items"`
+	}
+	err := json.Unmarshal([]byte(keywordCfgSchemaJSON), &schema)
+	c.Assert(err, IsNil)
+
+	props := schema.Items.Properties
+	c.Check(props["type"].Enum, HasLen, len(keywordTypes))
+	for _, t := range props["type"].Enum {
+		c.Check(keywordTypes[t], Equals, true)
+	}
+	// every field of keywordDef is described
+	typ := reflect.TypeOf(keywordDef{})
+	for i := 0; i < typ.NumField(); i++ {
+		_, ok := props[typ.Field(i).Tag.Get("json")]
+		c.Check(ok, Equals, true, Commentf("missing %s", typ.Field(i).Name))
+	}
+}
+
+func (s *xgettextTestSuite) TestFindProjectConfig(c *C) {
+	root := c.MkDir()
+	sub := filepath.Join(root, "cmd", "app")
+	c.Assert(os.MkdirAll(sub, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0644), IsNil)
+	c.Check(findProjectConfig(sub), Equals, "")
+
+	cfg := filepath.Join(root, projectConfigName)
+	c.Assert(ioutil.WriteFile(cfg, nil, 0644), IsNil)
+	c.Check(findProjectConfig(sub), Equals, cfg)
+}
+
+func (s *xgettextTestSuite) TestApplyProjectConfig(c *C) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	out := fs.String("output", "", "")
+	sortBy := fs.String("sort-output-by", "", "")
+	noLoc := fs.Bool("no-location", false, "")
+	var kws stringList
+	fs.Var(&kws, "keyword", "")
+	c.Assert(fs.Parse([]string{"--sort-output-by=file"}), IsNil)
+
+	dir := c.MkDir()
+	cfg := filepath.Join(dir, projectConfigName)
+	err := ioutil.WriteFile(cfg, []byte(`output: po/app.pot
+sort-output-by: msgid
+no-location: true
+keyword: [i18n.G, "i18n.NG:1,2"]
+`), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(applyProjectConfig(fs, cfg), IsNil)
+
+	c.Check(*out, Equals, filepath.Join(dir, "po/app.pot"))
+	// the command line wins
+	c.Check(*sortBy, Equals, "file")
+	c.Check(*noLoc, Equals, true)
+	c.Check(kws, DeepEquals, stringList{"i18n.G", "i18n.NG:1,2"})
+
+	err = ioutil.WriteFile(cfg, []byte("no-such-option: 1\n"), 0644)
+	c.Assert(err, IsNil)
+	err = applyProjectConfig(fs, cfg)
+	c.Check(err, ErrorMatches, `unknown option "no-such-option" in .*`)
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgYAMLAndTOML(c *C) {
+	one := 1
+	expected := keywords{
+		"tr.P": {Type: kTypeContextual, Name: "tr.P", MsgctxtArg: &one, Format: "go-format", AutoComment: "menu item"},
+	}
+	dir := c.MkDir()
+	for fname, content := range map[string]string{
+		"keywords.yaml": `- name: tr.P
+  type: contextual
+  msgctxtArg: 1
+  format: go-format
+  autoComment: menu item
+`,
+		"keywords.toml": `[[keyword]]
+name = "tr.P"
+type = "contextual"
+msgctxtArg = 1
+format = "go-format"
+autoComment = "menu item"
+`,
+	} {
+		cfg := filepath.Join(dir, fname)
+		err := ioutil.WriteFile(cfg, []byte(content), 0644)
+		c.Assert(err, IsNil)
+		keywordCfgs = stringList{cfg}
+		k, err := parseKeywords()
+		c.Assert(err, IsNil, Commentf(fname))
+		c.Check(k, DeepEquals, expected, Commentf(fname))
+	}
+
+	cfg := filepath.Join(dir, "broken.yml")
+	err := ioutil.WriteFile(cfg, []byte("- name: [\n"), 0644)
+	c.Assert(err, IsNil)
+	keywordCfgs = stringList{cfg}
+	_, err = parseKeywords()
+	c.Check(err, ErrorMatches, "cannot parse .*broken.yml: .*")
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgValidation(c *C) {
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	for _, test := range []struct {
+		content string
+		err     string
+	}{
+		{`{"name": "T"}`, `cannot parse .*keywords.json: json: cannot unmarshal object .*`},
+		{`[{"name": "T", "type": "plral"}]`, `.*keywords.json: keyword #1: unknown type "plral", expected one of: contextual, domain, plural, pluralContextual, pluralDomain, singular`},
+		{`[{"name": "T", "tpye": "singular"}]`, `.*keywords.json: keyword #1: unknown field "tpye"`},
+		{`[{"name": "T"}]`, `.*keywords.json: keyword #1: missing type`},
+		{`[{"type": "singular"}]`, `.*keywords.json: keyword #1: missing name`},
+		{`[{"name": "T", "type": "singular", "skipArgs": -1}]`, `.*keywords.json: keyword #1: negative skipArgs -1`},
+		{`[{"name": "T", "type": "plural", "msgidPluralArg": -2}]`, `.*keywords.json: keyword #1: negative msgidPluralArg -2`},
+		{`[{"name": "T", "type": "singular"}, {"name": "T", "type": "plural"}]`, `.*keywords.json: keyword #2: duplicate keyword "T"`},
+	} {
+		c.Assert(ioutil.WriteFile(cfg, []byte(test.content), 0644), IsNil)
+		keywordCfgs = stringList{cfg}
+		_, err := parseKeywords()
+		c.Check(err, ErrorMatches, test.err, Commentf(test.content))
+	}
+}
+
+func (s *xgettextTestSuite) TestWriteKeywords(c *C) {
+	keywordSpecs = stringList{"", "gotext.Get", "i18n.NG:1,2"}
+	keywordImportAliases = stringList{"github.com/leonelquinteros/gotext:gt"}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer(nil)
+	c.Assert(writeKeywords(out, k), IsNil)
+
+	// the output is a valid keyword configuration
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	c.Assert(ioutil.WriteFile(cfg, out.Bytes(), 0644), IsNil)
+	keywordSpecs = nil
+	keywordImportAliases = nil
+	keywordCfgs = stringList{cfg}
+	reread, err := parseKeywords()
+	c.Assert(err, IsNil)
+	zero, one := 0, 1
+	c.Check(reread, DeepEquals, keywords{
+		"gotext.Get": {Type: kTypeSingular, Name: "gotext.Get"},
+		"gt.Get":     {Type: kTypeSingular, Name: "gt.Get"},
+		"i18n.NG":    {Type: kTypePlural, Name: "i18n.NG", MsgidArg: &zero, MsgidPluralArg: &one},
+	})
+	c.Check(out.String(), Matches, `(?s)\[\n  \{\n    "type": "singular",\n    "name": "gotext.Get",.*`)
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgMerge(c *C) {
+	dir := c.MkDir()
+	libs := filepath.Join(dir, "libs")
+	c.Assert(os.Mkdir(libs, 0755), IsNil)
+	for fname, content := range map[string]string{
+		filepath.Join(libs, "a.json"):    `[{"name": "a.T", "type": "singular"}, {"name": "shared.T", "type": "singular"}]`,
+		filepath.Join(libs, "b.yaml"):    "- {name: b.T, type: plural}\n- {name: shared.T, type: singular}\n",
+		filepath.Join(libs, "README"):    "not a keyword config",
+		filepath.Join(dir, "app.json"):   `[{"name": "app.T", "type": "contextual"}]`,
+		filepath.Join(dir, "other.json"): `[{"name": "shared.T", "type": "singular", "skipArgs": 1}]`,
+	} {
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+
+	keywordCfgs = stringList{libs, filepath.Join(dir, "app.json")}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	c.Check(k, DeepEquals, keywords{
+		"a.T":      {Type: kTypeSingular, Name: "a.T"},
+		"b.T":      {Type: kTypePlural, Name: "b.T"},
+		"shared.T": {Type: kTypeSingular, Name: "shared.T"},
+		"app.T":    {Type: kTypeContextual, Name: "app.T"},
+	})
+
+	keywordCfgs = stringList{libs, filepath.Join(dir, "other.json")}
+	_, err = parseKeywords()
+	c.Check(err, ErrorMatches, `keyword "shared.T" is defined differently in .*b.yaml and .*other.json`)
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgNamePattern(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    msgFoo("foo")
+    msgs.Bar("bar")
+    msg("not matched")
+    trLabel("label only")
+}
+`))
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	err := ioutil.WriteFile(cfg, []byte(`[
+  {"name": "msg wrappers", "namePattern": "(main\\.)?msg[A-Z]\\w*", "type": "singular"},
+  {"name": "msgs package", "namePattern": "msgs\\..*", "type": "singular"},
+  {"name": "trLabel", "namePattern": "tr[A-Z]\\w*Text", "type": "singular"}
+]`), 0644)
+	c.Assert(err, IsNil)
+	keywordCfgs = stringList{cfg}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{{fname: fname, line: 4}},
+		"bar": []msgID{{fname: fname, line: 5}},
+	})
+
+	err = ioutil.WriteFile(cfg, []byte(`[{"name": "broken", "namePattern": "msg(", "type": "singular"}]`), 0644)
+	c.Assert(err, IsNil)
+	_, err = parseKeywords()
+	c.Check(err, ErrorMatches, `.*keywords.json: keyword #1: invalid namePattern: .*`)
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgImportPath(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import (
+    "example.com/a/i18n"
+    other "example.com/b/i18n"
+)
+
+func main() {
+    i18n.T("foo")
+    other.T(ctx, "bar")
+}
+`))
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	err := ioutil.WriteFile(cfg, []byte(`[
+  {"name": "T", "importPath": "example.com/a/i18n", "type": "singular"},
+  {"name": "T", "importPath": "example.com/b/i18n", "type": "singular", "skipArgs": 1}
+]`), 0644)
+	c.Assert(err, IsNil)
+	keywordCfgs = stringList{cfg}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{{fname: fname, line: 9}},
+		"bar": []msgID{{fname: fname, line: 10}},
+	})
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgMsgidArgs(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    dialog.New("Title", body, "OK")
+    buttons.Set(parent, "Yes", "No", "Cancel")
+}
+`))
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	err := ioutil.WriteFile(cfg, []byte(`[
+  {"name": "dialog.New", "type": "singular", "msgidArgs": [0, 2]},
+  {"name": "buttons.Set", "type": "singular", "msgidArgs": [1], "msgidRest": true}
+]`), 0644)
+	c.Assert(err, IsNil)
+	keywordCfgs = stringList{cfg}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Title":  []msgID{{fname: fname, line: 4}},
+		"OK":     []msgID{{fname: fname, line: 4}},
+		"Yes":    []msgID{{fname: fname, line: 5}},
+		"No":     []msgID{{fname: fname, line: 5}},
+		"Cancel": []msgID{{fname: fname, line: 5}},
+	})
+
+	err = ioutil.WriteFile(cfg, []byte(`[{"name": "ngettext", "type": "plural", "msgidArgs": [0, 1]}]`), 0644)
+	c.Assert(err, IsNil)
+	_, err = parseKeywords()
+	c.Assert(err, ErrorMatches, `.*keywords.json: keyword #1: type "plural" cannot have msgidArgs or msgidRest`)
+}
+
+func (s *xgettextTestSuite) TestKeywordCfgArgPositions(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    npgettext(domain, "menu", n, "file", "files")
+    skipped("foo", "bar")
+    npgettext("too few")
+}
+`))
+	cfg := filepath.Join(c.MkDir(), "keywords.json")
+	err := ioutil.WriteFile(cfg, []byte(`[
+  {"name": "npgettext", "type": "pluralContextual", "msgctxtArg": 1, "msgidArg": 3, "msgidPluralArg": 4},
+  {"name": "skipped", "type": "singular", "skipArgs": 1}
+]`), 0644)
+	c.Assert(err, IsNil)
+	keywordCfgs = stringList{cfg}
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Unable to obtain value at %s:6:5: missing argument 1\n", fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"menu\x04file": []msgID{
+			{
+				msgctxt:     "menu",
+				msgidPlural: "files",
+				fname:       fname,
+				line:        4,
+			},
+		},
+		"bar": []msgID{
+			{
+				fname: fname,
+				line:  5,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestParseKeywordArityErrors(c *C) {
+	for _, t := range []struct {
+		spec string
+		err  string
+	}{
+		{"MyT", `invalid keyword arity "MyT", expected NAME:TYPE:SKIPARGS\[:MSGIDARG\[:MSGIDPLURALARG\]\]`},
+		{"MyT:plral:0", `invalid keyword arity "MyT:plral:0", unknown type "plral"`},
+		{"MyT:singular:-1", `invalid keyword arity "MyT:singular:-1", invalid argument position "-1"`},
+	} {
+		_, err := parseKeywordArity(t.spec)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *xgettextTestSuite) TestKeywordBare(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import . "github.com/myorg/i18n"
+
+func main() {
+    _("test")
+    other._("not extracted")
+}
+`))
+	*keywordBare = "_"
+	k, err := parseKeywords()
+	c.Assert(err, IsNil)
+	s.e.Keywords = k
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"test": []msgID{
+			{
+				fname: fname,
+				line:  6,
+			},
+		},
+	})
+}
+
+func (s *xgettextTestSuite) TestWritePox(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo %s": []msgID{
+			{
+				fname:      "fname",
+				line:       2,
+				comment:    "#. TRANSLATORS: foo\n",
+				formatHint: "c-format",
+			},
+		},
+		"file": []msgID{
+			{
+				msgctxt:     "menu",
+				msgidPlural: "files",
+				fname:       "fname",
+				line:        4,
+			},
+		},
+	}
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.WritePox(out), IsNil)
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<po>
+  <message>
+    <location file="fname" line="4"></location>
+    <msgctxt>menu</msgctxt>
+    <msgid>file</msgid>
+    <msgid_plural>files</msgid_plural>
+    <msgstr index="0"></msgstr>
+    <msgstr index="1"></msgstr>
+  </message>
+  <message format="c-format">
+    <comment>TRANSLATORS: foo</comment>
+    <location file="fname" line="2"></location>
+    <msgid>foo %s</msgid>
+    <msgstr></msgstr>
+  </message>
+</po>
+`
+	c.Assert(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestTypeCheck(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+func G(msgid string) string { return msgid }
+`,
+		"main.go": `package main
+
+import (
+	loc "example.com/app/i18n"
+	. "example.com/app/i18n"
+)
+
+type translator struct{}
+
+func (translator) G(msgid string) string { return msgid }
+
+func main() {
+	loc.G("aliased")
+	G("dot import")
+
+	i18n := translator{}
+	i18n.G("shadowed")
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+
+	s.e.TypeCheck = true
+	err := s.e.Extract([]string{filepath.Join(dir, "main.go")})
+	c.Assert(err, IsNil)
+
+	var found []string
+	for k := range s.e.msgIDs {
+		found = append(found, k)
+	}
+	sort.Strings(found)
+	c.Check(found, DeepEquals, []string{"aliased", "dot import"})
+
+	// without type information only the textual match is found
+	s.e.TypeCheck = false
+	err = s.e.Extract([]string{filepath.Join(dir, "main.go")})
+	c.Assert(err, IsNil)
+	found = nil
+	for k := range s.e.msgIDs {
+		found = append(found, k)
+	}
+	c.Check(found, DeepEquals, []string{"shadowed"})
+}
+
+func (s *xgettextTestSuite) TestTypeCheckConsts(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+const Greeting = "Hello" + " world"
+
+func G(msgid string) string { return msgid }
+`,
+		"main.go": `package main
+
+import "example.com/app/i18n"
+
+const local = "Local"
+
+var dynamic = "Dynamic"
+
+func main() {
+	i18n.G(i18n.Greeting)
+	i18n.G(local)
+	i18n.G(dynamic)
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+	fname := filepath.Join(dir, "main.go")
+
+	s.e.TypeCheck = true
+	s.e.WarnDynamic = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Dynamic message argument at %s:12:2: not a constant: dynamic\n", fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Hello world": []msgID{{fname: fname, line: 10}},
+		"Local":       []msgID{{fname: fname, line: 11}},
+	})
+}
+
+func (s *xgettextTestSuite) TestTypeCheckErrorsOnce(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"main.go": `package main
+
+var count int = "many"
+
+func main() {
+	i18n.G("Hello")
+}
+`,
+		"main_test.go": `package main
+
+import "testing"
+
+func TestMain(t *testing.T) {}
+`,
+		"ext_test.go": `package main_test
+
+import "testing"
+
+func TestExt(t *testing.T) {}
+`,
+	}
+	for name, content := range sources {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+	}
+	fname := filepath.Join(dir, "main.go")
+
+	s.e.TypeCheck = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf(`WARN: %[1]s:3:17: cannot use "many" (untyped string constant) as int value in variable declaration
+WARN: %[1]s:6:2: undefined: i18n
+`, fname))
+}
+
+func (s *xgettextTestSuite) TestProcessFilesLocalVariables(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    msg := "Delete %d file?"
+    var msgPlural = "Delete %d files?"
+    i18n.NG(msg, msgPlural, n)
+
+    changed := "first"
+    changed = "second"
+    i18n.G(changed)
+}
+
+func other() {
+    i18n.G(msg)
+}
+`))
+
+	s.e.WarnDynamic = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Dynamic message argument at %s:10:5: unknown constant: changed\nWARN: Dynamic message argument at %s:14:5: unknown constant: msg\n", fname, fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Delete %d file?": []msgID{{fname: fname, line: 6, msgidPlural: "Delete %d files?", formatHint: "c-format"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestProcessFilesStringsJoin(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+import "strings"
+
+func main() {
+    i18n.G(strings.Join([]string{"line1", "line2"}, "\n"))
+    lines := []string{"a", "b" + "c"}
+    i18n.G(strings.Join(lines, ", "))
+    i18n.G(strings.Join([]string{"x", name}, " "))
+}
+`))
+
+	s.e.WarnDynamic = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf(`WARN: Dynamic message argument at %s:9:5: value is computed by a call: strings.Join([]string{…}, " ")
+`, fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"line1\\nline2": []msgID{{fname: fname, line: 6}},
+		"a, bc":         []msgID{{fname: fname, line: 8}},
+	})
+}
+
+func (s *xgettextTestSuite) TestProcessFilesNestedCalls(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G(fmt.Sprintf(i18n.G("inner %s"), name))
+    fmt.Errorf(i18n.G("cannot open %q"), path)
+    i18n.G(strings.TrimSpace(i18n.NG("one", "many", n)))
+}
+`))
+
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, "")
+
+	s.e.WarnDynamic = true
+	stderr = captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf(`WARN: Dynamic message argument at %[1]s:4:5: value is computed by a call: fmt.Sprintf(i18n.G("inner %%s"), name)
+WARN: Dynamic message argument at %[1]s:6:5: value is computed by a call: strings.TrimSpace(i18n.NG("one", "many", n))
+`, fname))
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"inner %s":       []msgID{{fname: fname, line: 4, formatHint: "c-format"}},
+		"cannot open %q": []msgID{{fname: fname, line: 5, formatHint: "go-format"}},
+		"one":            []msgID{{fname: fname, line: 6, msgidPlural: "many"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestProcessFilesDynamicIdentifiers(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G(userInput)
+    i18n.G(req.Title)
+    i18n.NG("one", plural, n)
+}
+`))
+
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, "")
+
+	s.e.WarnDynamic = true
+	stderr = captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf(`WARN: Dynamic message argument at %[1]s:4:5: unknown constant: userInput
+WARN: Dynamic message argument at %[1]s:5:5: unknown constant: req.Title
+WARN: Dynamic message argument at %[1]s:6:5: unknown constant: plural
+`, fname))
+	c.Check(s.e.msgIDs, HasLen, 0)
+}
+
+func (s *xgettextTestSuite) TestDiagnosticsJSON(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G(unknown)
+    i18n.G("")
+}
+`))
+
+	out := bytes.NewBuffer([]byte(""))
+	s.e.DiagnosticsFormat = "json"
+	s.e.DiagnosticsOutput = out
+	s.e.WarnDynamic = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	expected := fmt.Sprintf(`{"file":"%[1]s","line":4,"column":5,"severity":"warning","code":"dynamic-value","message":"Dynamic message argument at %[1]s:4:5: unknown constant: unknown"}
+{"file":"%[1]s","line":5,"column":5,"severity":"warning","code":"empty-msgid","message":"Empty msgid at %[1]s:5:5, it is reserved for the header"}
+`, fname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestParsePosition(c *C) {
+	for _, test := range []struct {
+		in  string
+		pos token.Position
+	}{
+		{"foo.go:3:5", token.Position{Filename: "foo.go", Line: 3, Column: 5}},
+		{"foo.go:3", token.Position{Filename: "foo.go", Line: 3}},
+		{"c:/foo.go:3:5", token.Position{Filename: "c:/foo.go", Line: 3, Column: 5}},
+		{"-", token.Position{Filename: "-"}},
+	} {
+		c.Check(parsePosition(test.in), Equals, test.pos, Commentf(test.in))
+	}
+}
+
+func (s *xgettextTestSuite) TestProcessFilesGenericKeywords(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G[Msg]("one type argument")
+    i18n.NG[Msg, int]("one", "many", n)
+    handlers[i]("not a keyword")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"one type argument": []msgID{{fname: fname, line: 4}},
+		"one":               []msgID{{fname: fname, line: 5, msgidPlural: "many"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestTypeCheckMethodKeywords(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+type Translator struct{}
+
+func (t *Translator) Gettext(msgid string) string { return msgid }
+`,
+		"main.go": `package main
+
+import "example.com/app/i18n"
+
+type other struct{}
+
+func (other) Gettext(msgid string) string { return msgid }
+
+func main() {
+	tr := &i18n.Translator{}
+	tr.Gettext("translated")
+
+	x := other{}
+	x.Gettext("unrelated")
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+
+	keywordCfgs = nil
+	keywordArities = stringList{"(*i18n.Translator).Gettext:singular:0"}
+	_, err := newExtractorFromFlags()
+	c.Assert(err, ErrorMatches, `method keyword "\(\*i18n.Translator\).Gettext" requires --type-check`)
+
+	*typeCheck = true
+	e, err := newExtractorFromFlags()
+	c.Assert(err, IsNil)
+	s.e.Keywords = e.Keywords
+	s.e.TypeCheck = true
+	err = s.e.Extract([]string{filepath.Join(dir, "main.go")})
+	c.Assert(err, IsNil)
+
+	var found []string
+	for k := range s.e.msgIDs {
+		found = append(found, k)
+	}
+	c.Check(found, DeepEquals, []string{"translated"})
+}
+
+func (s *xgettextTestSuite) TestValidateCalls(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+func NG(msgid, msgidPlural string, n interface{}) string { return msgid }
+`,
+		"main.go": `package main
+
+import "example.com/app/i18n"
+
+func main() {
+	i18n.NG("file", "files", 2)
+	i18n.NG("dir", "dirs", "many")
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+	fname := filepath.Join(dir, "main.go")
+
+	s.e.ValidateCalls = true
+	s.e.TypeCheck = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Argument 2 of i18n.NG at %s:7:2 is string, not an integer\n", fname))
+
+	// without type information only the argument count is checked
+	otherFname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.NG("file", "files")
+}
+`))
+	s.e.TypeCheck = false
+	stderr = captureStderr(c, func() {
+		err := s.e.Extract([]string{otherFname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, fmt.Sprintf("WARN: Call of i18n.NG at %s:4:5 has 2 arguments, expected at least 3\n", otherFname))
+}
+
+func (s *xgettextTestSuite) TestExtractDirective(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+// xgettext:extract
+var menu = []Entry{
+	{Label: "File", ID: 1},
+	{Label: "Edit", Help: i18n.G("Edit things")},
+}
+
+var ids = []string{"not", "extracted"}
+
+var labels = map[string]string{"a": "Alpha"} // xgettext:extract
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"File":        []msgID{{fname: fname, line: 5}},
+		"Edit":        []msgID{{fname: fname, line: 6}},
+		"Edit things": []msgID{{fname: fname, line: 6}},
+		"Alpha":       []msgID{{fname: fname, line: 11}},
+	})
+}
+
+func (s *xgettextTestSuite) TestIgnoreDirective(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("translated")
+    log.Print(i18n.G("protocol-key")) // xgettext:ignore
+    // xgettext:ignore
+    i18n.G("log-key")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Check(s.e.suppressed, Equals, 2)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"translated": []msgID{{fname: fname, line: 4}},
+	})
+}
+
+func (s *xgettextTestSuite) TestDirectiveLines(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    a() // xgettext:ignore
+    b()
+    // xgettext:extract
+    c()
+}
+`))
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fname, nil, parser.ParseComments)
+	c.Assert(err, IsNil)
+	c.Check(directiveLines(fset, f, directivePrefix), DeepEquals, map[int]string{
+		4: "ignore",
+		7: "extract",
+	})
+}
+
+func (s *xgettextTestSuite) TestAutoKeywords(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func T(msgid string) string { return i18n.G(msgid) }
+
+func TN(n int, msgid, msgidPlural string) string {
+	return i18n.NG(msgid, msgidPlural, n)
+}
+
+func Wrapped(msgid string) string { return T(msgid) }
+
+func main() {
+    T("wrapped")
+    TN(2, "file", "files")
+    Wrapped("twice")
+}
+`))
+	s.e.AutoKeywords = true
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, "")
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"wrapped": []msgID{{fname: fname, line: 12}},
+		"file":    []msgID{{fname: fname, line: 13, msgidPlural: "files"}},
+		"twice":   []msgID{{fname: fname, line: 14}},
+	})
+}
+
+func (s *xgettextTestSuite) TestAutoKeywordsKeepKeywordSettings(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func Label(msgid string) string { return ui.Button(msgid) }
+
+func main() {
+    Label("Save")
+}
+`))
+	s.e.Keywords["ui.Button"] = &keywordDef{Type: kTypeSingular, Name: "ui.Button", AutoComment: "This is a button label", Domain: "widgets"}
+	s.e.AutoKeywords = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Save": []msgID{{fname: fname, line: 6, autoComment: "#. This is a button label\n", domain: "widgets"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestLiteralLocation(c *C) {
+	fname := makeGoSourceFile(c, []byte("package main\n\nfunc main() {\n"+
+		"    i18n.G(\n"+
+		"        `first line\n"+
+		"second line\n"+
+		"third line`)\n"+
+		"    i18n.G(\"one line\")\n"+
+		"}\n"))
+	s.e.LiteralLocation = true
+	s.e.LocationEndLine = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := fmt.Sprintf(`%s
+#: %[2]s:4 %[2]s:5 %[2]s:7
+msgid   "first line\n"
+        "second line\n"
+        "third line"
+msgstr  ""
+
+#: %[2]s:8
+msgid   "one line"
+msgstr  ""
+
+`, header, fname)
+	c.Check(out.String(), Equals, expected)
+}
+
+func (s *xgettextTestSuite) TestLocationColumns(c *C) {
+	fname := makeGoSourceFile(c, []byte("package main\n\nfunc main() {\n"+
+		"    i18n.G(\"foo\")\n"+
+		"}\n"))
+	s.e.Columns = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"foo": []msgID{{fname: fname, line: 4, column: 5, offset: 32}},
+	})
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.WriteJSON(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*"line": 4,\s+"column": 5,\s+"offset": 32.*`)
+
+	out.Reset()
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, fmt.Sprintf(`(?s).*#: %s:4\n.*`, regexp.QuoteMeta(fname)))
+
+	s.e.LocationColumns = true
+	out.Reset()
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, fmt.Sprintf(`(?s).*#: %s:4:5\n.*`, regexp.QuoteMeta(fname)))
+}
+
+func (s *xgettextTestSuite) TestFormatI18nStr(c *C) {
+	for _, test := range []struct {
+		literal string
+		po      string
+	}{
+		{`"plain"`, `plain`},
+		{`"say \"hi\"\t\u00e9"`, `say \"hi\"\té`},
+		{"`raw \"quoted\" C:\\path\nnext`", `raw \"quoted\" C:\\path\nnext`},
+		{`"zero\u200bwidth"`, "zero\u200bwidth"},
+		{`"bell\x07 del\x7f nul\x00"`, `bell\a del\177 nul\000`},
+	} {
+		po := formatI18nStr(test.literal)
+		c.Check(po, Equals, test.po, Commentf(test.literal))
+		value, err := strconv.Unquote(test.literal)
+		c.Assert(err, IsNil)
+		c.Check(unescapeI18nStr(po), Equals, value, Commentf(test.literal))
+	}
+}
+
+func (s *xgettextTestSuite) TestWriteOutputEscapingRoundTrip(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("say \"hi\"\tnow")
+    i18n.G(`+"`C:\\path\\to`"+`)
+    i18n.CG("tab\there", "bell\a")
+    i18n.NG("one \\ slash", "many \\ slashes", n)
+}
+`))
+	s.e.PackageName = `my "app"`
+	s.e.Domain = "dom\"ain"
+	s.e.MsgidDomainPrefix = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	entries, err := parsePoFile(bytes.NewReader(out.Bytes()))
+	c.Assert(err, IsNil)
+	c.Check(entries[0].msgstr[0], Matches, `Project-Id-Version: my \\"app\\"\\n.*`)
+
+	type roundTrip struct{ msgctxt, msgid, msgidPlural string }
+	var values []roundTrip
+	for _, entry := range entries[1:] {
+		values = append(values, roundTrip{unescapeI18nStr(entry.msgctxt), unescapeI18nStr(entry.msgid), unescapeI18nStr(entry.msgidPlural)})
+	}
+	c.Check(values, DeepEquals, []roundTrip{
+		{"dom\"ain", `C:\path\to`, ""},
+		{"dom\"ain\x04tab\there", "bell\a", ""},
+		{"dom\"ain", `one \ slash`, `many \ slashes`},
+		{"dom\"ain", "say \"hi\"\tnow", ""},
+	})
+
+	// GNU msgfmt accepts the output when it is installed
+	if _, err := exec.LookPath("msgfmt"); err != nil {
+		return
+	}
+	potName := filepath.Join(c.MkDir(), "out.pot")
+	c.Assert(ioutil.WriteFile(potName, out.Bytes(), 0644), IsNil)
+	cmd := exec.Command("msgfmt", "--check-format", "-o", os.DevNull, potName)
+	output, err := cmd.CombinedOutput()
+	c.Check(err, IsNil, Commentf("%s", output))
+}
+
+func (s *xgettextTestSuite) TestMsgctxtComment(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("Open") // msgctxt: menu
+    // msgctxt: dialog title
+    i18n.G("Open")
+    i18n.CG("button", "Open") // msgctxt: ignored, the call has one
+    i18n.G("Open")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"menu\x04Open":         []msgID{{fname: fname, line: 4, msgctxt: "menu"}},
+		"dialog title\x04Open": []msgID{{fname: fname, line: 6, msgctxt: "dialog title"}},
+		"button\x04Open":       []msgID{{fname: fname, line: 7, msgctxt: "button"}},
+		"Open":                 []msgID{{fname: fname, line: 8}},
+	})
+}
+
+func (s *xgettextTestSuite) TestIntegrationSplitByDomain(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func main() {
+    i18n.G("default")
+    i18n.DG("ui", "Open")
+    i18n.DNG("errors", "%d error", "%d errors", n)
+}
+`))
+	outDir := c.MkDir()
+	os.Args = []string{"test-binary",
+		"--keyword-arity", "i18n.DG:domain:0",
+		"--keyword-arity", "i18n.DNG:pluralDomain:0",
+		"--split-by-domain",
+		"--output", filepath.Join(outDir, "ignored.pot"),
+		fname,
+	}
+
+	main()
+
+	for domain, msgid := range map[string]string{
+		"messages": "default",
+		"ui":       "Open",
+		"errors":   "%d error",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(outDir, domain+".pot"))
+		c.Assert(err, IsNil)
+		c.Check(strings.Count(string(got), "\nmsgid "), Equals, 2, Commentf(domain))
+		c.Check(string(got), Matches, fmt.Sprintf(`(?s).*\nmsgid   "%s"\n.*`, regexp.QuoteMeta(msgid)), Commentf(domain))
+	}
+	_, err := os.Stat(filepath.Join(outDir, "ignored.pot"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *xgettextTestSuite) TestCgoSources(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+func G(msgid string) string { return msgid }
+`,
+		"main.go": `package main
+
+/*
+#include <stdio.h>
+
+// i18n.G("not go")
+static const char *name = "C string";
+*/
+import "C"
+
+import "example.com/app/i18n"
+
+func main() {
+	// TRANSLATORS: from a cgo file
+	i18n.G("from cgo")
+	_ = C.name
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+	fname := filepath.Join(dir, "main.go")
+
+	expected := map[string][]msgID{
+		"from cgo": []msgID{{fname: fname, line: 15, comment: "#. TRANSLATORS: from a cgo file\n"}},
+	}
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Check(s.e.msgIDs, DeepEquals, expected)
+
+	// the go tool replaces cgo files by generated code
+	s.e.TypeCheck = true
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Check(s.e.msgIDs, DeepEquals, expected)
+}
+
+func (s *xgettextTestSuite) TestProcessFilesConstConcat(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+const prefix = "Error: "
+
+func main() {
+    const suffix = " not found"
+    i18n.G(prefix + "file" + suffix)
+    i18n.G("(" + prefix + ")")
+}
+`))
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Error: file not found": []msgID{{fname: fname, line: 7}},
+		"(Error: )":             []msgID{{fname: fname, line: 8}},
+	})
+}
+
+func (s *xgettextTestSuite) TestTypeCheckConstConcat(c *C) {
+	dir := c.MkDir()
+	sources := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.20\n",
+		"i18n/i18n.go": `package i18n
+
+type Msg string
+
+const Prefix Msg = "Error: "
+
+func G(msgid Msg) string { return string(msgid) }
+`,
+		"main.go": `package main
+
+import "example.com/app/i18n"
+
+func main() {
+	i18n.G(i18n.Prefix + "not found")
+}
+`,
+	}
+	for name, content := range sources {
+		fname := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(fname), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fname, []byte(content), 0644), IsNil)
+	}
+	fname := filepath.Join(dir, "main.go")
+
+	s.e.TypeCheck = true
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Error: not found": []msgID{{fname: fname, line: 6}},
+	})
+}
+
+func (s *xgettextTestSuite) TestProcessFilesContextConversion(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+type Ctx string
+
+const ctxMenu Ctx = "menu"
+
+func main() {
+    i18n.CG(ctxMenu, "Open")
+    i18n.CG(string(ctxMenu), "Save")
+    i18n.CG(Ctx("file"), "Close")
+}
+`))
+
+	stderr := captureStderr(c, func() {
+		err := s.e.Extract([]string{fname})
+		c.Assert(err, IsNil)
+	})
+	c.Check(stderr, Equals, "")
+
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"menu\x04Open":  []msgID{{fname: fname, line: 8, msgctxt: "menu"}},
+		"menu\x04Save":  []msgID{{fname: fname, line: 9, msgctxt: "menu"}},
+		"file\x04Close": []msgID{{fname: fname, line: 10, msgctxt: "file"}},
+	})
+}
+
+func (s *xgettextTestSuite) TestTrackFuncValues(c *C) {
+	fname := makeGoSourceFile(c, []byte(`package main
+
+func render(tmpl string, t func(string) string) string {
+    return t("Hello") + renderFooter(t)
+}
+
+func renderFooter(tr func(string) string) string {
+    return tr("Footer")
+}
+
+func main() {
+    render(tmpl, i18n.G)
+    tr := i18n.G
+    tr("Local")
+    other("Not extracted")
+}
+`))
+
+	err := s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Check(s.e.msgIDs, HasLen, 0)
+
+	s.e.TrackFuncValues = true
+	err = s.e.Extract([]string{fname})
+	c.Assert(err, IsNil)
+	c.Assert(s.e.msgIDs, DeepEquals, map[string][]msgID{
+		"Hello":  []msgID{{fname: fname, line: 4}},
+		"Footer": []msgID{{fname: fname, line: 8}},
+		"Local":  []msgID{{fname: fname, line: 14}},
+	})
+}
+
+func (s *xgettextTestSuite) TestWriteOutputWidth(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{{fname: "fname", line: 2}},
+		"The quick brown fox jumps over the lazy dog and keeps running through the field until dusk": []msgID{{fname: "fname", line: 3, msgctxt: "menu"}},
+		"first line\\nsecond line\\n": []msgID{{fname: "fname", line: 4}},
+	}
+	s.e.Width = 79
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+
+	expected := `# SOME DESCRIPTIVE TITLE.
+# Copyright (C) YEAR THE PACKAGE'S COPYRIGHT HOLDER
+# This file is distributed under the same license as the snappy package.
+# FIRST AUTHOR <EMAIL@ADDRESS>, YEAR.
+#
+#, fuzzy
+msgid ""
+msgstr ""
+"Project-Id-Version: snappy\n"
+"Report-Msgid-Bugs-To: snappy-devel@lists.ubuntu.com\n"
+"POT-Creation-Date: 2015-06-30 14:48+0200\n"
+"PO-Revision-Date: YEAR-MO-DA HO:MI+ZONE\n"
+"Last-Translator: FULL NAME <EMAIL@ADDRESS>\n"
+"Language-Team: LANGUAGE <LL@li.org>\n"
+"Language: \n"
+"MIME-Version: 1.0\n"
+"Content-Type: text/plain; charset=UTF-8\n"
+"Content-Transfer-Encoding: 8bit\n"
+
+#: fname:3
+msgctxt "menu"
+msgid ""
+"The quick brown fox jumps over the lazy dog and keeps running through the "
+"field until dusk"
+msgstr ""
+
+#: fname:4
+msgid ""
+"first line\n"
+"second line\n"
+msgstr ""
+
+#: fname:2
+msgid "foo"
+msgstr ""
+
+`
+	c.Check(out.String(), Equals, expected)
+
+	// long lines are kept with --no-wrap
+	s.e.NoWrap = true
+	s.e.OmitHeader = true
+	out.Reset()
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Matches, `(?s).*
+msgid "The quick brown fox jumps over the lazy dog and keeps running through the field until dusk"
+.*
+msgid ""
+"first line\\n"
+"second line\\n"
+.*`)
+}
+
+func (s *xgettextTestSuite) TestWriteOutputReferences(c *C) {
+	s.e.msgIDs = map[string][]msgID{
+		"foo": []msgID{
+			{fname: "b.go", line: 10},
+			{fname: "a.go", line: 9},
+			{fname: "b.go", line: 2},
+			{fname: "a.go", line: 9},
+			{fname: "a.go", line: 12, literalLine: 13},
+		},
+	}
+	s.e.OmitHeader = true
+	out := bytes.NewBuffer([]byte(""))
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, `#: a.go:9 a.go:12 a.go:13 b.go:2 b.go:10
+msgid   "foo"
+msgstr  ""
+
+`)
+
+	// long lines are wrapped between locations
+	s.e.Width = 30
+	out.Reset()
+	c.Assert(s.e.Write(out), IsNil)
+	c.Check(out.String(), Equals, `#: a.go:9 a.go:12 a.go:13
+#: b.go:2 b.go:10
+msgid "foo"
+msgstr ""
+
+`)
+}
@@ -0,0 +1,330 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadPackages loads the packages of fnames with their type information
+// and returns the syntax trees of fnames, keyed by file name. The go tool
+// is run in the directory of each file so that its module is used.
+func (e *Extractor) loadPackages(fset *token.FileSet, fnames []string) (map[string]*ast.File, error) {
+	// positions use the file names as given, not the absolute ones
+	// reported by the go tool
+	names := make(map[string]string)
+	given := make(map[string]bool)
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, fname := range fnames {
+		abs, err := filepath.Abs(fname)
+		if err != nil {
+			return nil, err
+		}
+		names[abs] = fname
+		given[fname] = true
+		dir := filepath.Dir(abs)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	files := make(map[string]*ast.File)
+	// with tests a package is loaded up to three times, its errors are
+	// reported once
+	reported := make(map[string]bool)
+	for _, dir := range dirs {
+		cfg := &packages.Config{
+			Mode:  packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+			Dir:   dir,
+			Fset:  fset,
+			Tests: !e.SkipTests,
+			ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+				if name, ok := names[filename]; ok {
+					filename = name
+				}
+				return parser.ParseFile(fset, filename, src, parser.ParseComments)
+			},
+		}
+		if e.BuildContext != nil {
+			cfg.Env = append(os.Environ(), "GOOS="+e.BuildContext.GOOS, "GOARCH="+e.BuildContext.GOARCH)
+			cfg.BuildFlags = []string{"-tags=" + strings.Join(e.BuildContext.BuildTags, ",")}
+		}
+		pkgs, err := packages.Load(cfg, ".")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pkg := range pkgs {
+			typeErrors := false
+			for _, pkgErr := range pkg.Errors {
+				typeErrors = typeErrors || pkgErr.Kind == packages.TypeError
+			}
+			for _, pkgErr := range pkg.Errors {
+				// the compiler output go list reports repeats the
+				// type errors
+				if typeErrors && pkgErr.Kind == packages.ListError {
+					continue
+				}
+				if reported[pkgErr.Error()] {
+					continue
+				}
+				reported[pkgErr.Error()] = true
+				e.warnf(parsePosition(pkgErr.Pos), "type-check", "%v\n", pkgErr)
+			}
+			for _, f := range pkg.Syntax {
+				// the syntax of cgo files is that of the generated
+				// code, //line comments point to the original file
+				fname := fset.PositionFor(f.Pos(), false).Filename
+				if !given[fname] {
+					continue
+				}
+				// files not given to Extract are ignored by it
+				files[fname] = f
+				e.typesInfo[f] = pkg.TypesInfo
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// typedFuncNames returns the keyword names a call of fun can match: the
+// import path and the package name qualified function name, for methods
+// (*pkg.Type).Method and pkg.Type.Method. ok is false if fun is not
+// known to the type checker.
+func typedFuncNames(info *types.Info, fun ast.Expr) (names []string, ok bool) {
+	var ident *ast.Ident
+	switch x := fun.(type) {
+	case *ast.Ident:
+		ident = x
+	case *ast.SelectorExpr:
+		ident = x.Sel
+	default:
+		return nil, false
+	}
+	obj, ok := info.Uses[ident]
+	if !ok {
+		return nil, false
+	}
+	fn, isFunc := obj.(*types.Func)
+	if !isFunc || fn.Pkg() == nil {
+		// known, but not a function
+		return nil, true
+	}
+	qualifiers := []string{fn.Pkg().Path(), fn.Pkg().Name()}
+
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		for _, q := range qualifiers {
+			names = append(names, fmt.Sprintf("%s.%s", q, fn.Name()))
+		}
+		return names, true
+	}
+
+	recvType := recv.Type()
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		recvType = ptr.Elem()
+	}
+	named, ok := recvType.(*types.Named)
+	if !ok {
+		// methods of unnamed interfaces
+		return nil, true
+	}
+	for _, q := range qualifiers {
+		names = append(names,
+			fmt.Sprintf("(*%s.%s).%s", q, named.Obj().Name(), fn.Name()),
+			fmt.Sprintf("%s.%s.%s", q, named.Obj().Name(), fn.Name()))
+	}
+	return names, true
+}
+
+// lookupKeyword returns the keyword called by fun, with type information
+// the called function decides, otherwise the text of fun. Explicit type
+// arguments are ignored.
+func (e *Extractor) lookupKeyword(f *ast.File, fun ast.Expr) (*keywordDef, bool) {
+	// generic keywords are called like i18n.T[Msg]("foo")
+	switch x := fun.(type) {
+	case *ast.IndexExpr:
+		fun = x.X
+	case *ast.IndexListExpr:
+		fun = x.X
+	}
+
+	if info := e.typesInfo[f]; info != nil {
+		if names, ok := typedFuncNames(info, fun); ok {
+			for _, name := range names {
+				if keyword, ok := e.keywordByName(name); ok {
+					return keyword, true
+				}
+			}
+			return nil, false
+		}
+	}
+
+	name := parseFunExpr("", fun)
+	if name == "" {
+		return nil, false
+	}
+	if keyword, ok := e.keywordByName(name); ok {
+		return keyword, true
+	}
+	// keywords with an ImportPath
+	if sel, ok := fun.(*ast.SelectorExpr); ok {
+		if importPath := importPathOf(f, sel.X); importPath != "" {
+			if keyword, ok := e.Keywords[importPath+"."+sel.Sel.Name]; ok && keyword.NamePattern == "" {
+				return keyword, true
+			}
+		}
+	}
+	// wrappers called from their own package
+	if _, ok := fun.(*ast.Ident); ok {
+		return e.keywordByName(f.Name.Name + "." + name)
+	}
+	return nil, false
+}
+
+// majorVersionRe matches the major version suffix of a module path,
+// like the "v2" element of "example.com/lib/v2" or the ".v3" of
+// "gopkg.in/yaml.v3"
+var majorVersionRe = regexp.MustCompile(`(?:^|\.)v[0-9]+$`)
+
+// defaultPackageName returns the name a package is conventionally
+// referred to by when importing importPath without a name, that is the
+// last path element without a major version suffix
+func defaultPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if loc := majorVersionRe.FindStringIndex(name); loc != nil {
+		switch {
+		case loc[0] == 0 && strings.Contains(importPath, "/"):
+			name = path.Base(path.Dir(importPath))
+		case loc[0] > 0 && strings.HasPrefix(importPath, "gopkg.in/"):
+			name = name[:loc[0]]
+		}
+	}
+	return name
+}
+
+// importPathOf returns the path of the package expr refers to in f if
+// it is an imported package name
+func importPathOf(f *ast.File, expr ast.Expr) string {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := defaultPackageName(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == ident.Name {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// keywordByName returns the configured or discovered keyword name. The
+// name of a keyword with a NamePattern is only a label, the pattern
+// alone decides which functions it matches.
+func (e *Extractor) keywordByName(name string) (*keywordDef, bool) {
+	if keyword, ok := e.Keywords[name]; ok && keyword.NamePattern == "" {
+		return keyword, true
+	}
+	if keyword, ok := e.wrappers[name]; ok {
+		return keyword, true
+	}
+	for _, pattern := range e.patterns {
+		if pattern.re.MatchString(name) {
+			return pattern.def, true
+		}
+	}
+	return nil, false
+}
+
+// keywordPattern is a keyword with a compiled NamePattern
+type keywordPattern struct {
+	re  *regexp.Regexp
+	def *keywordDef
+}
+
+// compileKeywordPatterns returns the keywords with a NamePattern
+// sorted by name, the patterns must match the whole function name
+func compileKeywordPatterns(k keywords) ([]keywordPattern, error) {
+	var patterns []keywordPattern
+	for _, def := range k {
+		if def.NamePattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + def.NamePattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern of keyword %q: %v", def.Name, err)
+		}
+		patterns = append(patterns, keywordPattern{re: re, def: def})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].def.Name < patterns[j].def.Name
+	})
+	return patterns, nil
+}
+
+// typedConstValue returns the value of expr, quoted like a string
+// literal, if the type checker knows it to be a string constant. Unlike
+// the const table this also follows constants of packages not given to
+// Extract.
+func typedConstValue(info *types.Info, expr ast.Expr) (string, error) {
+	tv, ok := info.Types[expr]
+	if !ok {
+		return "", &dynamicValueError{expr, "unknown constant"}
+	}
+	if tv.Value == nil {
+		return "", &dynamicValueError{expr, "not a constant"}
+	}
+	if tv.Value.Kind() != constant.String {
+		return "", fmt.Errorf("not a string constant: %s", types.ExprString(expr))
+	}
+	return strconv.Quote(constant.StringVal(tv.Value)), nil
+}
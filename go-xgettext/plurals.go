@@ -0,0 +1,107 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"strings"
+)
+
+// pluralForms maps language codes to their gettext Plural-Forms, the
+// rules follow the CLDR plural categories
+var pluralForms = map[string]string{
+	"af":    "nplurals=2; plural=(n != 1);",
+	"ar":    "nplurals=6; plural=(n==0 ? 0 : n==1 ? 1 : n==2 ? 2 : n%100>=3 && n%100<=10 ? 3 : n%100>=11 ? 4 : 5);",
+	"be":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"bg":    "nplurals=2; plural=(n != 1);",
+	"bs":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"ca":    "nplurals=2; plural=(n != 1);",
+	"cs":    "nplurals=3; plural=(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2;",
+	"da":    "nplurals=2; plural=(n != 1);",
+	"de":    "nplurals=2; plural=(n != 1);",
+	"el":    "nplurals=2; plural=(n != 1);",
+	"en":    "nplurals=2; plural=(n != 1);",
+	"eo":    "nplurals=2; plural=(n != 1);",
+	"es":    "nplurals=2; plural=(n != 1);",
+	"et":    "nplurals=2; plural=(n != 1);",
+	"eu":    "nplurals=2; plural=(n != 1);",
+	"fi":    "nplurals=2; plural=(n != 1);",
+	"fr":    "nplurals=2; plural=(n > 1);",
+	"ga":    "nplurals=5; plural=n==1 ? 0 : n==2 ? 1 : (n>2 && n<7) ? 2 : (n>6 && n<11) ? 3 : 4;",
+	"gl":    "nplurals=2; plural=(n != 1);",
+	"he":    "nplurals=2; plural=(n != 1);",
+	"hr":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"hu":    "nplurals=2; plural=(n != 1);",
+	"id":    "nplurals=1; plural=0;",
+	"it":    "nplurals=2; plural=(n != 1);",
+	"ja":    "nplurals=1; plural=0;",
+	"ko":    "nplurals=1; plural=0;",
+	"lt":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"lv":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n != 0 ? 1 : 2);",
+	"ms":    "nplurals=1; plural=0;",
+	"nb":    "nplurals=2; plural=(n != 1);",
+	"nl":    "nplurals=2; plural=(n != 1);",
+	"nn":    "nplurals=2; plural=(n != 1);",
+	"oc":    "nplurals=2; plural=(n > 1);",
+	"pl":    "nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"pt":    "nplurals=2; plural=(n != 1);",
+	"pt_BR": "nplurals=2; plural=(n > 1);",
+	"ro":    "nplurals=3; plural=(n==1 ? 0 : (n==0 || (n%100 > 0 && n%100 < 20)) ? 1 : 2);",
+	"ru":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"sk":    "nplurals=3; plural=(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2;",
+	"sl":    "nplurals=4; plural=(n%100==1 ? 0 : n%100==2 ? 1 : n%100==3 || n%100==4 ? 2 : 3);",
+	"sr":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"sv":    "nplurals=2; plural=(n != 1);",
+	"th":    "nplurals=1; plural=0;",
+	"tr":    "nplurals=2; plural=(n != 1);",
+	"uk":    "nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);",
+	"vi":    "nplurals=1; plural=0;",
+	"zh":    "nplurals=1; plural=0;",
+}
+
+// lookupPluralForms finds the Plural-Forms for a language like "de",
+// "pt_BR" or "de_DE.UTF-8"
+func lookupPluralForms(lang string) (string, bool) {
+	lang = strings.SplitN(lang, ".", 2)[0]
+	lang = strings.Replace(lang, "-", "_", -1)
+	if rule, ok := pluralForms[lang]; ok {
+		return rule, true
+	}
+	rule, ok := pluralForms[strings.SplitN(lang, "_", 2)[0]]
+	return rule, ok
+}
+
+const genericPluralFormsComment = "#. msgid_plural is the plural form of msgid, provide one msgstr[N] for each plural form of the language as given by the Plural-Forms header\n"
+
+func pluralFormsComment(lang string) string {
+	if lang == "" {
+		return genericPluralFormsComment
+	}
+	if rule, ok := lookupPluralForms(lang); ok {
+		return "#. Plural-Forms: " + rule + "\n"
+	}
+	return genericPluralFormsComment
+}
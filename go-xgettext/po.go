@@ -0,0 +1,265 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// poEntry is a single entry of a PO (or POT) file, strings are kept
+// escaped just like the keys of msgIDs
+type poEntry struct {
+	translatorComments []string
+	extractedComments  []string
+	references         []string
+	flags              []string
+	msgctxt            string
+	msgid              string
+	msgidPlural        string
+	msgstr             []string
+	obsolete           bool
+}
+
+func (e *poEntry) isHeader() bool {
+	return e.msgid == "" && e.msgctxt == ""
+}
+
+func (e *poEntry) isFuzzy() bool {
+	for _, flag := range e.flags {
+		if flag == "fuzzy" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *poEntry) isTranslated() bool {
+	if len(e.msgstr) == 0 || e.isFuzzy() {
+		return false
+	}
+	for _, str := range e.msgstr {
+		if str == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePoString returns the escaped content of a "..." PO string
+func parsePoString(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("invalid string %s", s)
+	}
+	return s[1 : len(s)-1], nil
+}
+
+func parsePoFile(r io.Reader) ([]*poEntry, error) {
+	var entries []*poEntry
+	var entry *poEntry
+	// the string continuation lines are appended to
+	var cur *string
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		obsolete := false
+		if strings.HasPrefix(line, "#~") {
+			obsolete = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "#~"))
+		}
+		if line == "" {
+			cur = nil
+			continue
+		}
+
+		// a comment or keyword after a msgstr starts a new entry
+		if entry == nil || (len(entry.msgstr) > 0 && !strings.HasPrefix(line, `"`) && !strings.HasPrefix(line, "msgstr[")) {
+			entry = &poEntry{}
+			entries = append(entries, entry)
+		}
+		entry.obsolete = entry.obsolete || obsolete
+
+		var err error
+		switch {
+		case strings.HasPrefix(line, "#."):
+			entry.extractedComments = append(entry.extractedComments, strings.TrimSpace(line[2:]))
+		case strings.HasPrefix(line, "#:"):
+			entry.references = append(entry.references, strings.Fields(line[2:])...)
+		case strings.HasPrefix(line, "#,"):
+			for _, flag := range strings.Split(line[2:], ",") {
+				entry.flags = append(entry.flags, strings.TrimSpace(flag))
+			}
+		case strings.HasPrefix(line, "#"):
+			entry.translatorComments = append(entry.translatorComments, strings.TrimSpace(line[1:]))
+		case strings.HasPrefix(line, `"`):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: unexpected string", lineno)
+			}
+			var str string
+			str, err = parsePoString(line)
+			*cur += str
+		case strings.HasPrefix(line, "msgctxt"):
+			entry.msgctxt, err = parsePoString(line[len("msgctxt"):])
+			cur = &entry.msgctxt
+		case strings.HasPrefix(line, "msgid_plural"):
+			entry.msgidPlural, err = parsePoString(line[len("msgid_plural"):])
+			cur = &entry.msgidPlural
+		case strings.HasPrefix(line, "msgid"):
+			entry.msgid, err = parsePoString(line[len("msgid"):])
+			cur = &entry.msgid
+		case strings.HasPrefix(line, "msgstr"):
+			idx := strings.IndexAny(line, ` "`)
+			if idx < 0 {
+				return nil, fmt.Errorf("line %d: missing string", lineno)
+			}
+			var str string
+			str, err = parsePoString(line[idx:])
+			entry.msgstr = append(entry.msgstr, str)
+			cur = &entry.msgstr[len(entry.msgstr)-1]
+		default:
+			err = fmt.Errorf("unexpected %q", line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// parsePotFile reads the entries of a POT file as msgIDs, keeping the
+// translator comments and fuzzy marks, the header is skipped
+func parsePotFile(r io.Reader) (map[string][]msgID, error) {
+	entries, err := parsePoFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string][]msgID)
+	for _, entry := range entries {
+		if entry.isHeader() {
+			continue
+		}
+		m := msgID{
+			msgctxt:     entry.msgctxt,
+			msgidPlural: entry.msgidPlural,
+			fuzzy:       entry.isFuzzy(),
+		}
+		for _, com := range entry.translatorComments {
+			m.translatorComment += fmt.Sprintf("# %s\n", com)
+		}
+		var hints []string
+		for _, flag := range entry.flags {
+			if flag != "fuzzy" {
+				hints = append(hints, flag)
+			}
+		}
+		m.formatHint = strings.Join(hints, ", ")
+
+		k := msgIDKey(entry.msgctxt, entry.msgid)
+		if len(entry.references) == 0 {
+			ids[k] = append(ids[k], m)
+		}
+		for _, ref := range entry.references {
+			m.fname = ref
+			m.line = 0
+			if idx := strings.LastIndex(ref, ":"); idx > 0 {
+				if line, err := strconv.Atoi(ref[idx+1:]); err == nil {
+					m.fname, m.line = ref[:idx], line
+				}
+			}
+			ids[k] = append(ids[k], m)
+		}
+	}
+
+	return ids, nil
+}
+
+// Join merges the entries of the existing POT file read from r into
+// the result of Extract: extracted entries get the translator comments
+// and fuzzy marks of the existing ones, existing entries that were not
+// extracted are dropped or, with KeepObsolete, kept as obsolete
+func (e *Extractor) Join(r io.Reader) error {
+	existing, err := parsePotFile(r)
+	if err != nil {
+		return err
+	}
+
+	for k, old := range existing {
+		if cur, ok := e.msgIDs[k]; ok {
+			cur[0].translatorComment = old[0].translatorComment
+			cur[0].fuzzy = old[0].fuzzy
+			continue
+		}
+		if e.KeepObsolete {
+			e.obsoleteMsgIDs[k] = old[:1]
+		}
+	}
+
+	return nil
+}
+
+// checkCompleteness reports all untranslated entries to w and returns
+// the percentage of translated entries
+func checkCompleteness(r io.Reader, w io.Writer) (percent float64, missing int, err error) {
+	entries, err := parsePoFile(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total := 0
+	for _, entry := range entries {
+		if entry.isHeader() || entry.obsolete {
+			continue
+		}
+		total++
+		if entry.isTranslated() {
+			continue
+		}
+		missing++
+		fmt.Fprintf(w, "missing translation for msgid \"%s\"", entry.msgid)
+		if len(entry.references) > 0 {
+			fmt.Fprintf(w, " at %s", strings.Join(entry.references, " "))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if total == 0 {
+		return 100, 0, nil
+	}
+
+	return 100 * float64(total-missing) / float64(total), missing, nil
+}
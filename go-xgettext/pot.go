@@ -0,0 +1,746 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const potDateFormat = "2006-01-02 15:04-0700"
+
+var formatTime = func() string {
+	return time.Now().Format(potDateFormat)
+}
+
+var currentYear = func() int {
+	return time.Now().Year()
+}
+
+var runGit = func(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func gitRevisionDate(fnames []string) (string, error) {
+	args := append([]string{"log", "-1", "--format=%cI", "--"}, fnames...)
+	out, err := runGit(args...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "", fmt.Errorf("no commits found")
+	}
+	t, err := time.Parse(time.RFC3339, out)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(potDateFormat), nil
+}
+
+// gitFileMetadata is the git metadata of a file, the "#. Added:"
+// comment of the file and the "#. Last-modified:" comments of its lines
+type gitFileMetadata struct {
+	added string
+	lines map[int]string
+}
+
+// gitMetadataComment returns the "#. Added:" style comments for line of
+// fname. The added date is the one of the file, the last modification
+// the one of the line according to git blame. Results are cached per
+// file as they need two git invocations.
+func (e *Extractor) gitMetadataComment(cache map[string]*gitFileMetadata, fname string, line int) string {
+	meta, ok := cache[fname]
+	if !ok {
+		meta = &gitFileMetadata{}
+		added, err := runGit("log", "--diff-filter=A", "--format=%ai", "--", fname)
+		if err == nil && added != "" {
+			// the oldest commit is listed last
+			lines := strings.Split(added, "\n")
+			meta.added = fmt.Sprintf("#. Added: %.10s\n", lines[len(lines)-1])
+		}
+		if err == nil {
+			var blame string
+			blame, err = runGit("blame", "--porcelain", "--", fname)
+			meta.lines = blameComments(blame)
+		}
+		if err != nil {
+			e.warnf(token.Position{Filename: fname}, "git-metadata", "Unable to obtain git metadata for %s: %v\n", fname, err)
+		}
+		cache[fname] = meta
+	}
+
+	return meta.added + meta.lines[line]
+}
+
+// blameHeaderRe matches the first line of a line group in the output of
+// git blame --porcelain, with the commit and the final line number
+var blameHeaderRe = regexp.MustCompile(`^([0-9a-f]{40}) [0-9]+ ([0-9]+)`)
+
+// blameCommit is a commit in the output of git blame --porcelain
+type blameCommit struct {
+	author, authorTime, authorTz string
+}
+
+// comment returns the "#. Last-modified:" and "#. Last-modifier:"
+// comments for the commit, the date as seen by the author
+func (c *blameCommit) comment() string {
+	sec, err := strconv.ParseInt(c.authorTime, 10, 64)
+	if err != nil {
+		return ""
+	}
+	t := time.Unix(sec, 0).UTC()
+	if tz, err := time.Parse("-0700", c.authorTz); err == nil {
+		t = t.In(tz.Location())
+	}
+	com := fmt.Sprintf("#. Last-modified: %s\n", t.Format("2006-01-02"))
+	if c.author != "" {
+		com += fmt.Sprintf("#. Last-modifier: %s\n", c.author)
+	}
+	return com
+}
+
+// blameComments returns the "#. Last-modified:" comments of the lines
+// in the output of git blame --porcelain by line number. Lines that are
+// not committed yet have none.
+func blameComments(blame string) map[int]string {
+	commits := make(map[string]*blameCommit)
+	lineCommits := make(map[int]*blameCommit)
+	var commit *blameCommit
+	for _, l := range strings.Split(blame, "\n") {
+		if m := blameHeaderRe.FindStringSubmatch(l); m != nil {
+			commit = nil
+			if m[1] == strings.Repeat("0", 40) {
+				continue
+			}
+			if commit = commits[m[1]]; commit == nil {
+				commit = &blameCommit{}
+				commits[m[1]] = commit
+			}
+			n, _ := strconv.Atoi(m[2])
+			lineCommits[n] = commit
+			continue
+		}
+		if commit == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "author "):
+			commit.author = strings.TrimPrefix(l, "author ")
+		case strings.HasPrefix(l, "author-time "):
+			commit.authorTime = strings.TrimPrefix(l, "author-time ")
+		case strings.HasPrefix(l, "author-tz "):
+			commit.authorTz = strings.TrimPrefix(l, "author-tz ")
+		}
+	}
+
+	lines := make(map[int]string)
+	for n, commit := range lineCommits {
+		lines[n] = commit.comment()
+	}
+	return lines
+}
+
+func (e *Extractor) formatLanguageTeam() string {
+	switch {
+	case e.LanguageTeam != "":
+		return e.LanguageTeam
+	case e.Language != "" && e.TranslationURL != "":
+		return fmt.Sprintf("%s <%s>", e.Language, e.TranslationURL)
+	case e.Language != "":
+		return e.Language
+	}
+	return "LANGUAGE <LL@li.org>"
+}
+
+// formatCopyright returns the year and holder of the copyright line,
+// the year defaults to the current one once a holder is known
+func (e *Extractor) formatCopyright() string {
+	year := "YEAR"
+	switch {
+	case e.CopyrightYear != 0:
+		year = strconv.Itoa(e.CopyrightYear)
+	case e.CopyrightHolder != "" && !e.CreationTime.IsZero():
+		year = strconv.Itoa(e.CreationTime.Year())
+	case e.CopyrightHolder != "":
+		year = strconv.Itoa(currentYear())
+	}
+	holder := e.CopyrightHolder
+	if holder == "" {
+		holder = "THE PACKAGE'S COPYRIGHT HOLDER"
+	}
+	return year + " " + holder
+}
+
+// formatCreationDate returns the POT-Creation-Date, CreationTime or
+// the current time
+func (e *Extractor) formatCreationDate() string {
+	if !e.CreationTime.IsZero() {
+		return e.CreationTime.Format(potDateFormat)
+	}
+	return formatTime()
+}
+
+func (e *Extractor) formatRevisionDate() string {
+	if e.RevisionDateFromGit {
+		date, err := gitRevisionDate(e.processedFiles)
+		if err == nil {
+			return date
+		}
+		e.warnf(token.Position{}, "git-revision-date", "Unable to obtain git revision date: %v\n", err)
+	}
+	if e.RevisionDate {
+		return e.formatCreationDate()
+	}
+	return "YEAR-MO-DA HO:MI+ZONE"
+}
+
+var sortOrders = map[string]func(e *Extractor, a, b string) bool{
+	"msgid": func(e *Extractor, a, b string) bool {
+		msgidA, msgidB := msgidFromKey(a), msgidFromKey(b)
+		if msgidA != msgidB {
+			return msgidA < msgidB
+		}
+		return a < b
+	},
+	"context": func(e *Extractor, a, b string) bool {
+		ctxtA, ctxtB := e.msgIDs[a][0].msgctxt, e.msgIDs[b][0].msgctxt
+		if ctxtA != ctxtB {
+			return ctxtA < ctxtB
+		}
+		return a < b
+	},
+	"file": (*Extractor).lessByFile,
+	// the order in which the files were processed
+	"occurrence": func(e *Extractor, a, b string) bool {
+		idxA, idxB := e.fileIndex(e.msgIDs[a][0].fname), e.fileIndex(e.msgIDs[b][0].fname)
+		if idxA != idxB {
+			return idxA < idxB
+		}
+		return e.lessByFile(a, b)
+	},
+}
+
+// lessByFile orders entries by their first location like GNU
+// xgettext --sort-by-file, that is the first one of their "#:" lines
+func (e *Extractor) lessByFile(a, b string) bool {
+	locA, locB := e.firstReference(a), e.firstReference(b)
+	if locA.fname != locB.fname {
+		return locA.fname < locB.fname
+	}
+	if locA.line != locB.line {
+		return locA.line < locB.line
+	}
+	if locA.column != locB.column {
+		return locA.column < locB.column
+	}
+	return a < b
+}
+
+// firstReference returns the first location of the entry k in file,
+// line and column order
+func (e *Extractor) firstReference(k string) reference {
+	first := reference{fname: e.msgIDs[k][0].fname, line: e.msgIDs[k][0].line, column: e.msgIDs[k][0].column}
+	for _, msgid := range e.msgIDs[k][1:] {
+		ref := reference{fname: msgid.fname, line: msgid.line, column: msgid.column}
+		if ref.fname < first.fname || ref.fname == first.fname && (ref.line < first.line || ref.line == first.line && ref.column < first.column) {
+			first = ref
+		}
+	}
+	return first
+}
+
+func (e *Extractor) fileIndex(fname string) int {
+	for i, processed := range e.processedFiles {
+		if e.locationName(processed) == fname {
+			return i
+		}
+	}
+	return len(e.processedFiles)
+}
+
+func (e *Extractor) sortedMsgIDKeys() []string {
+	// yes, this is the way to do it in go
+	sortedKeys := []string{}
+	for k := range e.msgIDs {
+		sortedKeys = append(sortedKeys, k)
+	}
+
+	if less, ok := sortOrders[e.SortBy]; ok {
+		sort.Slice(sortedKeys, func(i, j int) bool {
+			return less(e, sortedKeys[i], sortedKeys[j])
+		})
+	}
+	return sortedKeys
+}
+
+// pluralSlots returns the number of msgstr[N] lines of plural entries
+func (e *Extractor) pluralSlots() int {
+	if e.PluralForms > 0 {
+		return e.PluralForms
+	}
+	return 2
+}
+
+// headerField is a "Key: value" line of the header entry
+type headerField struct {
+	key, value string
+}
+
+// headerFields returns the fields of the header entry in order, with
+// HeaderFields replacing or adding to the default ones
+func (e *Extractor) headerFields() []headerField {
+	charset := e.Charset
+	if charset == "" {
+		charset = "CHARSET"
+	}
+	projectID := e.PackageName
+	if e.PackageVersion != "" {
+		projectID = strings.TrimSpace(projectID + " " + e.PackageVersion)
+	}
+
+	fields := []headerField{
+		{"Project-Id-Version", projectID},
+		{"Report-Msgid-Bugs-To", e.MsgIDBugsAddress},
+		{"POT-Creation-Date", e.formatCreationDate()},
+		{"PO-Revision-Date", e.formatRevisionDate()},
+		{"Last-Translator", "FULL NAME <EMAIL@ADDRESS>"},
+		{"Language-Team", e.formatLanguageTeam()},
+		{"Language", e.Language},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=" + charset},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	if e.NoDate {
+		fields = append(fields[:2], fields[3:]...)
+	}
+	switch {
+	case e.PluralFormula != "":
+		fields = append(fields, headerField{"Plural-Forms", e.PluralFormula})
+	case e.PluralForms != 0 && e.PluralForms != 2:
+		fields = append(fields, headerField{"Plural-Forms", fmt.Sprintf("nplurals=%d; plural=EXPRESSION;", e.PluralForms)})
+	}
+
+next:
+	for _, field := range e.HeaderFields {
+		for i := range fields {
+			if strings.EqualFold(fields[i].key, field.key) {
+				fields[i].value = field.value
+				continue next
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// writeHeader writes the header entry of the PO template
+func (e *Extractor) writeHeader(out io.Writer) {
+	fuzzy := "#, fuzzy\n"
+	if e.NoFuzzy {
+		fuzzy = ""
+	}
+
+	packageName := e.PackageName
+	if packageName == "" {
+		packageName = "PACKAGE"
+	}
+	// like GNU xgettext, foreign users do not assign a copyright
+	copyright := fmt.Sprintf(`# Copyright (C) %s
+# This file is distributed under the same license as the %s package.
+`, e.formatCopyright(), packageName)
+	if e.ForeignUser {
+		copyright = "# This file is put in the public domain.\n"
+	}
+
+	header := fmt.Sprintf(`# SOME DESCRIPTIVE TITLE.
+%s# FIRST AUTHOR <EMAIL@ADDRESS>, YEAR.
+#
+%s`, copyright, fuzzy)
+	fmt.Fprintf(out, "%s", header)
+
+	fields := ""
+	for _, field := range e.headerFields() {
+		fields += poEscape(field.key+": "+field.value) + `\n`
+	}
+	fmt.Fprintf(out, "%s", e.formatString("", "msgid", ""))
+	fmt.Fprintf(out, "%s", e.formatString("", "msgstr", fields))
+	fmt.Fprintf(out, "\n")
+}
+
+// defaultDomain is the domain of strings without one, as in GNU gettext
+const defaultDomain = "messages"
+
+// splitByDomain returns an Extractor per domain holding only the
+// strings of that domain, obsolete entries are dropped
+func (e *Extractor) splitByDomain() map[string]*Extractor {
+	split := make(map[string]*Extractor)
+	for k, msgidList := range e.msgIDs {
+		for _, m := range msgidList {
+			domain := m.domain
+			if domain == "" {
+				domain = defaultDomain
+			}
+			de, ok := split[domain]
+			if !ok {
+				copied := *e
+				copied.msgIDs = make(map[string][]msgID)
+				copied.obsoleteMsgIDs = nil
+				de = &copied
+				split[domain] = de
+			}
+			de.msgIDs[k] = append(de.msgIDs[k], m)
+		}
+	}
+	return split
+}
+
+// entryComments returns the extracted comments of all occurrences of
+// an entry, a comment shared by several calls is only returned once
+func (e *Extractor) entryComments(msgidList []msgID) []string {
+	var comments []string
+	seen := make(map[string]bool)
+	add := func(comment string) {
+		if comment == "" || seen[comment] {
+			return
+		}
+		seen[comment] = true
+		comments = append(comments, comment)
+	}
+	for _, msgid := range msgidList {
+		add(msgid.autoComment)
+		if e.AddComments || len(e.AddCommentsTags) > 0 {
+			add(msgid.comment)
+		}
+	}
+	return comments
+}
+
+// reference is a location of an entry in the "#:" lines
+type reference struct {
+	fname  string
+	line   int
+	column int
+}
+
+func (r reference) String() string {
+	switch {
+	case r.column != 0:
+		return fmt.Sprintf("%s:%d:%d", r.fname, r.line, r.column)
+	case r.line != 0:
+		return fmt.Sprintf("%s:%d", r.fname, r.line)
+	}
+	return r.fname
+}
+
+// the values of AddLocation, like the GNU xgettext --add-location
+const (
+	locationFull  = "full"
+	locationFile  = "file"
+	locationNever = "never"
+)
+
+// entryLocations returns the occurrences of an entry whose locations
+// the JSON and XML outputs list, with locationFile only one per file
+// without line and column
+func (e *Extractor) entryLocations(msgidList []msgID) []msgID {
+	switch e.AddLocation {
+	case locationNever:
+		return nil
+	case locationFile:
+		var locations []msgID
+		seen := make(map[string]bool)
+		for _, msgid := range msgidList {
+			if !seen[msgid.fname] {
+				seen[msgid.fname] = true
+				locations = append(locations, msgID{fname: msgid.fname})
+			}
+		}
+		return locations
+	}
+	return msgidList
+}
+
+// entryReferences returns the locations of all occurrences of an entry
+// sorted by file, line and column, each location is only returned once
+func (e *Extractor) entryReferences(msgidList []msgID) []reference {
+	var refs []reference
+	seen := make(map[reference]bool)
+	add := func(ref reference) {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	for _, msgid := range msgidList {
+		if e.AddLocation == locationFile {
+			add(reference{fname: msgid.fname})
+			continue
+		}
+		ref := reference{fname: msgid.fname, line: msgid.line}
+		if e.LocationColumns {
+			ref.column = msgid.column
+		}
+		add(ref)
+		for _, line := range []int{msgid.literalLine, msgid.endLine} {
+			if line != 0 && line != msgid.line {
+				add(reference{fname: msgid.fname, line: line})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].fname != refs[j].fname {
+			return refs[i].fname < refs[j].fname
+		}
+		if refs[i].line != refs[j].line {
+			return refs[i].line < refs[j].line
+		}
+		return refs[i].column < refs[j].column
+	})
+	return refs
+}
+
+// formatReferences returns the "#:" lines of an entry, with Width they
+// are wrapped like GNU xgettext does, never splitting a location
+func (e *Extractor) formatReferences(msgidList []msgID) string {
+	out := "#:"
+	column := len(out)
+	for _, ref := range e.entryReferences(msgidList) {
+		s := ref.String()
+		if e.Width > 0 && !e.NoWrap && column > len("#:") && column+1+utf8.RuneCountInString(s) > e.Width {
+			out += "\n#:"
+			column = len("#:")
+		}
+		out += " " + s
+		column += 1 + utf8.RuneCountInString(s)
+	}
+	return out + "\n"
+}
+
+// entryFormatHint returns the format hint of an entry, that of the
+// first occurrence used as format string if any. Contradicting flags
+// like c-format and no-c-format are rejected by the GNU tools, so an
+// entry only ever gets one.
+func entryFormatHint(msgidList []msgID) string {
+	hint := ""
+	for _, msgid := range msgidList {
+		if msgid.formatHint == "" {
+			continue
+		}
+		if !strings.HasPrefix(msgid.formatHint, "no-") {
+			return msgid.formatHint
+		}
+		if hint == "" {
+			hint = msgid.formatHint
+		}
+	}
+	return hint
+}
+
+// keywordPadding aligns the strings of the default layout after their
+// keyword, msgstr[N] is padded like msgstr
+var keywordPadding = map[string]string{
+	"msgctxt":      " ",
+	"msgid":        "   ",
+	"msgid_plural": "   ",
+}
+
+// formatString returns the PO lines of keyword with the escaped string
+// s, each prefixed by prefix. With Width or NoWrap they follow the GNU
+// xgettext layout, see wrapString, otherwise s is split after each \n
+// with aligned continuation lines (obsolete entries are not split).
+func (e *Extractor) formatString(prefix, keyword, s string) string {
+	if e.Width > 0 || e.NoWrap {
+		width := e.Width
+		if e.NoWrap {
+			width = 0
+		}
+		return wrapString(prefix, keyword, s, width)
+	}
+
+	padding, ok := keywordPadding[keyword]
+	if !ok {
+		padding = "  "
+	}
+	if prefix == "" {
+		// split string with \n into multiple lines
+		// to make the output nicer
+		s = strings.Replace(s, "\\n", "\\n\"\n        \"", -1)
+		// cleanup too aggressive splitting (empty "" lines)
+		s = strings.TrimSuffix(s, "\"\n        \"")
+	}
+	return fmt.Sprintf("%s%s%s\"%s\"\n", prefix, keyword, padding, s)
+}
+
+// wrapString returns the PO lines of keyword with the escaped string s
+// like GNU xgettext writes them: on a single line if s fits into width
+// columns and has no \n but at its end, otherwise as "" followed by a
+// line for each part of s ending with \n, parts longer than width are
+// broken after spaces. A width of 0 does not break the parts.
+func wrapString(prefix, keyword, s string, width int) string {
+	// the parts end after each \n, escapes are never split
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			continue
+		}
+		i++
+		if s[i] == 'n' && i+1 < len(s) {
+			parts = append(parts, s[start:i+1])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+
+	line := fmt.Sprintf("%s%s \"%s\"", prefix, keyword, s)
+	if len(parts) == 1 && (width == 0 || utf8.RuneCountInString(line) <= width) {
+		return line + "\n"
+	}
+
+	lines := []string{fmt.Sprintf("%s%s \"\"", prefix, keyword)}
+	// the columns left for a part between its quotes
+	avail := width - utf8.RuneCountInString(prefix) - 2
+	for _, part := range parts {
+		cur := ""
+		for _, word := range splitAfterSpaces(part) {
+			if width > 0 && cur != "" && utf8.RuneCountInString(cur+word) > avail {
+				lines = append(lines, fmt.Sprintf("%s\"%s\"", prefix, cur))
+				cur = ""
+			}
+			cur += word
+		}
+		lines = append(lines, fmt.Sprintf("%s\"%s\"", prefix, cur))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// splitAfterSpaces splits s after each run of spaces
+func splitAfterSpaces(s string) []string {
+	var words []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' && (i+1 == len(s) || s[i+1] != ' ') {
+			words = append(words, s[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// Write writes the extracted strings as a PO template
+func (e *Extractor) Write(w io.Writer) error {
+	var out bytes.Buffer
+
+	if !e.OmitHeader {
+		e.writeHeader(&out)
+	}
+
+	metadataCache := make(map[string]*gitFileMetadata)
+
+	// FIXME: use template here?
+	for _, k := range e.sortedMsgIDKeys() {
+		msgidList := e.msgIDs[k]
+		fmt.Fprintf(&out, "%s", msgidList[0].translatorComment)
+		if e.AddMetadata {
+			fmt.Fprintf(&out, "%s", e.gitMetadataComment(metadataCache, msgidList[0].fname, msgidList[0].line))
+		}
+		for _, comment := range e.entryComments(msgidList) {
+			fmt.Fprintf(&out, "%s", comment)
+		}
+		if e.AddPluralFormsComment && msgidList[0].msgidPlural != "" {
+			fmt.Fprintf(&out, "%s", pluralFormsComment(e.Language))
+		}
+		if e.AddLocation != locationNever {
+			fmt.Fprintf(&out, "%s", e.formatReferences(msgidList))
+		}
+		msgid := msgidList[0]
+		var flags []string
+		if msgid.fuzzy {
+			flags = append(flags, "fuzzy")
+		}
+		if hint := entryFormatHint(msgidList); hint != "" {
+			flags = append(flags, hint)
+		}
+		if len(flags) > 0 {
+			fmt.Fprintf(&out, "#, %s\n", strings.Join(flags, ", "))
+		}
+		if msgid.msgctxt != "" {
+			fmt.Fprintf(&out, "%s", e.formatString("", "msgctxt", msgid.msgctxt))
+		}
+		fmt.Fprintf(&out, "%s", e.formatString("", "msgid", msgidFromKey(k)))
+		if msgid.msgidPlural != "" {
+			fmt.Fprintf(&out, "%s", e.formatString("", "msgid_plural", msgid.msgidPlural))
+			for i := 0; i < e.pluralSlots(); i++ {
+				fmt.Fprintf(&out, "%s", e.formatString("", fmt.Sprintf("msgstr[%d]", i), ""))
+			}
+		} else {
+			fmt.Fprintf(&out, "%s", e.formatString("", "msgstr", ""))
+		}
+		fmt.Fprintf(&out, "\n")
+	}
+
+	// obsolete entries go last, like msgmerge does
+	var obsoleteKeys []string
+	for k := range e.obsoleteMsgIDs {
+		obsoleteKeys = append(obsoleteKeys, k)
+	}
+	sort.Strings(obsoleteKeys)
+	for _, k := range obsoleteKeys {
+		msgid := e.obsoleteMsgIDs[k][0]
+		fmt.Fprintf(&out, "%s", msgid.translatorComment)
+		if msgid.msgctxt != "" {
+			fmt.Fprintf(&out, "%s", e.formatString("#~ ", "msgctxt", msgid.msgctxt))
+		}
+		fmt.Fprintf(&out, "%s", e.formatString("#~ ", "msgid", msgidFromKey(k)))
+		if msgid.msgidPlural != "" {
+			fmt.Fprintf(&out, "%s", e.formatString("#~ ", "msgid_plural", msgid.msgidPlural))
+			for i := 0; i < e.pluralSlots(); i++ {
+				fmt.Fprintf(&out, "%s", e.formatString("#~ ", fmt.Sprintf("msgstr[%d]", i), ""))
+			}
+		} else {
+			fmt.Fprintf(&out, "%s", e.formatString("#~ ", "msgstr", ""))
+		}
+		fmt.Fprintf(&out, "\n")
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
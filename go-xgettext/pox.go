@@ -0,0 +1,115 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type poxLocation struct {
+	File   string `xml:"file,attr"`
+	Line   int    `xml:"line,attr,omitempty"`
+	Column int    `xml:"column,attr,omitempty"`
+	Offset int    `xml:"offset,attr,omitempty"`
+}
+
+type poxMsgstr struct {
+	Index *int   `xml:"index,attr"`
+	Text  string `xml:",chardata"`
+}
+
+type poxMessage struct {
+	Format      string        `xml:"format,attr,omitempty"`
+	Comments    []string      `xml:"comment"`
+	Locations   []poxLocation `xml:"location"`
+	Msgctxt     string        `xml:"msgctxt,omitempty"`
+	Msgid       string        `xml:"msgid"`
+	MsgidPlural string        `xml:"msgid_plural,omitempty"`
+	Msgstr      []poxMsgstr   `xml:"msgstr"`
+}
+
+type pox struct {
+	XMLName  xml.Name     `xml:"po"`
+	Messages []poxMessage `xml:"message"`
+}
+
+// extractedComments turns "#. " comment lines into plain text lines
+func extractedComments(com string) []string {
+	var lines []string
+	for _, line := range strings.Split(com, "\n") {
+		if line != "" {
+			lines = append(lines, strings.TrimPrefix(line, "#. "))
+		}
+	}
+	return lines
+}
+
+// WritePox writes the strings in the GNU gettext XML format
+func (e *Extractor) WritePox(w io.Writer) error {
+	doc := pox{}
+	for _, k := range e.sortedMsgIDKeys() {
+		msgidList := e.msgIDs[k]
+		msgid := msgidList[0]
+		msg := poxMessage{
+			Msgctxt:     unescapeI18nStr(msgid.msgctxt),
+			Msgid:       unescapeI18nStr(msgidFromKey(k)),
+			MsgidPlural: unescapeI18nStr(msgid.msgidPlural),
+		}
+		msg.Format = entryFormatHint(msgidList)
+		for _, comment := range e.entryComments(msgidList) {
+			msg.Comments = append(msg.Comments, extractedComments(comment)...)
+		}
+		for _, m := range e.entryLocations(msgidList) {
+			msg.Locations = append(msg.Locations, poxLocation{File: m.fname, Line: m.line, Column: m.column, Offset: m.offset})
+		}
+		if msgid.msgidPlural != "" {
+			for i := 0; i < e.pluralSlots(); i++ {
+				idx := i
+				msg.Msgstr = append(msg.Msgstr, poxMsgstr{Index: &idx})
+			}
+		} else {
+			msg.Msgstr = []poxMsgstr{{}}
+		}
+		doc.Messages = append(doc.Messages, msg)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s", xml.Header)
+	enc := xml.NewEncoder(&out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	fmt.Fprintf(&out, "\n")
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keywordPreset configures the keywords of a Go i18n library
+type keywordPreset struct {
+	keywords []*keywordDef
+	// struct fields as given to --keyword-field
+	fields []string
+	// pluralFields pair the msgid field with the msgid_plural field,
+	// by type name as in fields
+	pluralFields map[string]map[string]string
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// github.com/leonelquinteros/gotext, the context follows the msgid
+var gotextPreset = keywordPreset{
+	keywords: []*keywordDef{
+		{Type: kTypeSingular, Name: "gotext.Get"},
+		{Type: kTypePlural, Name: "gotext.GetN"},
+		{Type: kTypeDomain, Name: "gotext.GetD"},
+		{Type: kTypePluralDomain, Name: "gotext.GetND"},
+		{Type: kTypeContextual, Name: "gotext.GetC", MsgidArg: intPtr(0), MsgctxtArg: intPtr(1)},
+		{Type: kTypePluralContextual, Name: "gotext.GetNC", MsgidArg: intPtr(0), MsgidPluralArg: intPtr(1), MsgctxtArg: intPtr(3)},
+		// there is no type with both a domain and a context, the
+		// domain argument is skipped
+		{Type: kTypeContextual, Name: "gotext.GetDC", MsgidArg: intPtr(1), MsgctxtArg: intPtr(2)},
+		{Type: kTypePluralContextual, Name: "gotext.GetNDC", MsgidArg: intPtr(1), MsgidPluralArg: intPtr(2), MsgctxtArg: intPtr(4)},
+	},
+}
+
+// keywordPresets are selected with --preset
+var keywordPresets = map[string]keywordPreset{
+	// github.com/nicksnyder/go-i18n/v2/i18n, One and Other of an
+	// i18n.Message literal are its msgid and msgid_plural. Zero, Two,
+	// Few and Many are CLDR plural categories that have no msgid of
+	// their own in gettext, they are left to the translations.
+	"go-i18n": {
+		fields: []string{
+			"i18n.Message.One",
+			"i18n.Message.Other",
+		},
+		pluralFields: map[string]map[string]string{
+			"i18n.Message": {"One": "Other"},
+		},
+	},
+	"gotext":          gotextPreset,
+	"leonelquinteros": gotextPreset,
+	// github.com/snapcore/snapd/i18n
+	"snapcore": {
+		keywords: []*keywordDef{
+			{Type: kTypeSingular, Name: "i18n.G"},
+			{Type: kTypePlural, Name: "i18n.NG"},
+		},
+	},
+}
+
+// presetNames returns the sorted names of keywordPresets
+func presetNames() string {
+	var names []string
+	for name := range keywordPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// selectedPresets returns the presets with the given names
+func selectedPresets(names []string) ([]keywordPreset, error) {
+	var selected []keywordPreset
+	for _, name := range names {
+		preset, ok := keywordPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q, expected one of: %s", name, presetNames())
+		}
+		selected = append(selected, preset)
+	}
+	return selected, nil
+}
@@ -0,0 +1,86 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const resxHeader = `<?xml version="1.0" encoding="utf-8"?>
+<root>
+  <resheader name="resmimetype">
+    <value>text/microsoft-resx</value>
+  </resheader>
+  <resheader name="version">
+    <value>2.0</value>
+  </resheader>
+  <resheader name="reader">
+    <value>System.Resources.ResXResourceReader, System.Windows.Forms, Version=4.0.0.0, Culture=neutral, PublicKeyToken=b77a5c561934e089</value>
+  </resheader>
+  <resheader name="writer">
+    <value>System.Resources.ResXResourceWriter, System.Windows.Forms, Version=4.0.0.0, Culture=neutral, PublicKeyToken=b77a5c561934e089</value>
+  </resheader>
+`
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func writeResxData(out io.Writer, name string) {
+	fmt.Fprintf(out, "  <data name=\"%s\" xml:space=\"preserve\">\n", xmlEscape(name))
+	fmt.Fprintf(out, "    <value></value>\n")
+	fmt.Fprintf(out, "  </data>\n")
+}
+
+// WriteResx writes the strings as .NET resources, the msgid is
+// used as resource name and the values are left empty
+func (e *Extractor) WriteResx(w io.Writer) error {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s", resxHeader)
+	for _, k := range e.sortedMsgIDKeys() {
+		msgid := e.msgIDs[k][0]
+		name := unescapeI18nStr(msgidFromKey(k))
+		if msgid.msgctxt != "" {
+			name = unescapeI18nStr(msgid.msgctxt) + "." + name
+		}
+		if msgid.msgidPlural != "" {
+			writeResxData(&out, name+"_one")
+			writeResxData(&out, name+"_other")
+		} else {
+			writeResxData(&out, name)
+		}
+	}
+	fmt.Fprintf(&out, "</root>\n")
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
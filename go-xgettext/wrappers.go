@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2015-2016 Canonical Ltd
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation
+ * files (the "Software"), to deal in the Software without
+ * restriction, including without limitation the rights to use, copy,
+ * modify, merge, publish, distribute, sublicense, and/or sell copies
+ * of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// discoverWrappers finds the functions of files that only return the
+// result of a keyword call with their own parameters as the message
+// arguments, e.g.
+//
+//	func G(msgid string) string { return gettext.Gettext(msgid) }
+//
+// and adds them to e.wrappers, keyed by package and function name.
+// Wrappers of wrappers are found as well.
+func (e *Extractor) discoverWrappers(fset *token.FileSet, files []*ast.File) {
+	for found := true; found; {
+		found = false
+		for _, f := range files {
+			for _, decl := range f.Decls {
+				fdecl, ok := decl.(*ast.FuncDecl)
+				if !ok || fdecl.Recv != nil {
+					continue
+				}
+				name := f.Name.Name + "." + fdecl.Name.Name
+				if _, ok := e.wrappers[name]; ok {
+					continue
+				}
+				call, keyword := e.wrappedKeywordCall(f, fdecl)
+				if keyword == nil {
+					continue
+				}
+				wrapper := wrapperKeyword(name, fdecl, call, keyword)
+				if wrapper == nil {
+					continue
+				}
+				e.wrappers[name] = wrapper
+				e.wrapperCalls[call] = true
+				found = true
+				if e.Verbose {
+					pos := fset.Position(fdecl.Pos())
+					e.notef(pos, "wrapper", "Using %s as keyword, it wraps %s\n", name, keyword.Name)
+				}
+			}
+		}
+	}
+}
+
+// wrappedKeywordCall returns the keyword call fdecl consists of
+func (e *Extractor) wrappedKeywordCall(f *ast.File, fdecl *ast.FuncDecl) (*ast.CallExpr, *keywordDef) {
+	if fdecl.Body == nil || len(fdecl.Body.List) != 1 {
+		return nil, nil
+	}
+	ret, ok := fdecl.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return nil, nil
+	}
+	call, ok := ret.Results[0].(*ast.CallExpr)
+	if !ok {
+		return nil, nil
+	}
+	keyword, ok := e.lookupKeyword(f, call.Fun)
+	if !ok {
+		return nil, nil
+	}
+	return call, keyword
+}
+
+// wrapperKeyword returns the keyword definition of the wrapper fdecl
+// around the keyword call, or nil if a message argument of the call is
+// not a parameter of fdecl
+func wrapperKeyword(name string, fdecl *ast.FuncDecl, call *ast.CallExpr, keyword *keywordDef) *keywordDef {
+	params := make(map[string]int)
+	idx := 0
+	for _, field := range fdecl.Type.Params.List {
+		for _, paramName := range field.Names {
+			params[paramName.Name] = idx
+			idx++
+		}
+		if len(field.Names) == 0 {
+			idx++
+		}
+	}
+	paramIdx := func(argIdx int) *int {
+		if argIdx >= len(call.Args) {
+			return nil
+		}
+		ident, ok := call.Args[argIdx].(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		i, ok := params[ident.Name]
+		if !ok {
+			return nil
+		}
+		return &i
+	}
+
+	wrapper := &keywordDef{
+		Type:        keyword.Type,
+		Name:        name,
+		Format:      keyword.Format,
+		Domain:      keyword.Domain,
+		AutoComment: keyword.AutoComment,
+	}
+	if wrapper.MsgidArg = paramIdx(keyword.msgidIdx()); wrapper.MsgidArg == nil {
+		return nil
+	}
+	// the rest arguments cannot be told apart from the parameters
+	if keyword.MsgidRest {
+		return nil
+	}
+	for _, argIdx := range keyword.MsgidArgs {
+		i := paramIdx(argIdx)
+		if i == nil {
+			return nil
+		}
+		wrapper.MsgidArgs = append(wrapper.MsgidArgs, *i)
+	}
+	switch keyword.Type {
+	case kTypeContextual, kTypePluralContextual:
+		if wrapper.MsgctxtArg = paramIdx(keyword.msgctxtIdx()); wrapper.MsgctxtArg == nil {
+			return nil
+		}
+	}
+	switch keyword.Type {
+	case kTypeDomain, kTypePluralDomain:
+		if wrapper.DomainArg = paramIdx(keyword.domainIdx()); wrapper.DomainArg == nil {
+			return nil
+		}
+	}
+	switch keyword.Type {
+	case kTypePlural, kTypePluralContextual, kTypePluralDomain:
+		if wrapper.MsgidPluralArg = paramIdx(keyword.msgidPluralIdx()); wrapper.MsgidPluralArg == nil {
+			return nil
+		}
+	}
+	return wrapper
+}